@@ -2,4 +2,7 @@ package main
 
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
\ No newline at end of file
+const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// holds the logged in models.User, set by authenticate()
+const currentUserContextKey = contextKey("currentUser")
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// settings for the /events stream
+const (
+	// events a browser can fall behind by before it's disconnected, it
+	// reconnects and catches up from the history
+	eventsBuffer = 16
+	eventsHistory = 100
+	// how long browsers wait before reconnecting, in milliseconds
+	eventsRetry = 5000
+)
+
+// name of the event sent for a newly published snippet
+const eventSnippet = "snippet"
+
+// what's sent to browsers about a newly published snippet
+type snippetEvent struct {
+	ID int `json:"id"`
+	Title string `json:"title"`
+	// formatted with humanDate, the same as on the page
+	Created string `json:"created"`
+}
+
+// announces s on /events once it's been published, hidden and held
+// snippets are left out
+func (app *application) publishSnippet(s models.Snippet) error {
+	if s.Hidden || s.Held {
+		return nil
+	}
+
+	data, err := json.Marshal(snippetEvent{
+		ID: s.ID,
+		Title: s.Title,
+		Created: humanDate(s.Created),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.events.Publish(eventSnippet, string(data))
+
+	return nil
+}
+
+// streams newly published snippets as server-sent events. Browsers that
+// reconnect send the ID of the last event they saw in Last-Event-ID and get
+// what they missed first. A comment is sent every app.eventsHeartbeat so
+// proxies don't close the connection for being idle.
+func (app *application) eventStream(w http.ResponseWriter, r *http.Request) {
+	sub, missed, err := app.events.Subscribe(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		// shutting down
+		app.clientError(w, http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	// the stream lasts far longer than the server's write timeout
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", eventsRetry)
+	if err != nil {
+		return
+	}
+	for _, e := range missed {
+		_, err = e.WriteTo(w)
+		if err != nil {
+			return
+		}
+	}
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			// dropped for falling behind, or shutting down, either way the
+			// browser reconnects
+			if !ok {
+				return
+			}
+			_, err = e.WriteTo(w)
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/models"
+)
+
+// opens an event stream, the response body is closed when the test ends
+func openStream(t *testing.T, ts *testServer, lastID string) (*http.Response, *bufio.Reader) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rs.Body.Close() })
+
+	return rs, bufio.NewReader(rs.Body)
+}
+
+// reads the fields of the next event, or comment, up to the blank line
+// that ends it
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	fields := make(map[string]string)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return fields
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = strings.TrimPrefix(value, " ")
+	}
+}
+
+// reads the next event, skipping heartbeats
+func nextEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	for {
+		e := readEvent(t, r)
+		if _, ok := e[""]; !ok {
+			return e
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	app := newTestApplication(t)
+	app.eventsHeartbeat = 10 * time.Millisecond
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	rs, r := openStream(t, ts, "")
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/event-stream")
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "no-store")
+
+	assert.Equal(t, readEvent(t, r)["retry"], "5000")
+
+	t.Run("Heartbeat", func(t *testing.T) {
+		assert.Equal(t, readEvent(t, r)[""], "heartbeat")
+	})
+
+	var firstID string
+
+	t.Run("Created snippet", func(t *testing.T) {
+		csrfToken := ts.login(t, "alice@example.com")
+
+		form := url.Values{}
+		form.Add("title", "O snail")
+		form.Add("content", "O snail")
+		form.Add("expires", "7")
+		form.Add("csrf_token", csrfToken)
+
+		code, _, _ := ts.postForm(t, "/snippet/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		e := nextEvent(t, r)
+		assert.Equal(t, e["event"], "snippet")
+		assert.StringContains(t, e["data"], `"id":2,"title":"O snail"`)
+		firstID = e["id"]
+	})
+
+	t.Run("Held and hidden snippets", func(t *testing.T) {
+		for _, id := range []int{3, 4} {
+			s, err := app.snippets.Get(id)
+			assert.NilError(t, err)
+			assert.NilError(t, app.publishSnippet(s))
+		}
+
+		// the next event is the one after them
+		assert.NilError(t, app.publishSnippet(models.Snippet{ID: 7, Title: "Frog"}))
+		assert.StringContains(t, nextEvent(t, r)["data"], `"id":7`)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		rs, r := openStream(t, ts, firstID)
+		assert.Equal(t, rs.StatusCode, http.StatusOK)
+
+		readEvent(t, r)
+		assert.StringContains(t, nextEvent(t, r)["data"], `"id":7`)
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		app.events.Close()
+
+		// the open stream ends
+		_, err := r.ReadString('\n')
+		for err == nil {
+			_, err = r.ReadString('\n')
+		}
+
+		code, _, _ := ts.get(t, "/events")
+		assert.Equal(t, code, http.StatusServiceUnavailable)
+	})
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// feed formats, also the extension of the feed's URL
+const (
+	feedFormatAtom = "atom"
+	feedFormatRSS = "rss"
+)
+
+// number of snippets in a user's feed, the site feed has what Latest returns
+const userFeedEntries = 20
+
+// what both feed formats are built from
+type feed struct {
+	title string
+	description string
+	// the page the feed follows
+	link string
+	// the feed itself
+	self string
+	// when the newest entry was published, zero if there are no entries
+	updated time.Time
+	entries []feedEntry
+}
+
+type feedEntry struct {
+	title string
+	link string
+	content string
+	author string
+	authorLink string
+	published time.Time
+}
+
+// adds a snippet to the feed
+func (f *feed) add(baseURL string, s models.Snippet, author models.User) {
+	name := author.Name
+	if name == "" {
+		name = "Unknown"
+	}
+
+	f.entries = append(f.entries, feedEntry{
+		title: s.Title,
+		link: fmt.Sprintf("%s/snippet/view/%d", baseURL, s.ID),
+		content: s.Content,
+		author: name,
+		authorLink: fmt.Sprintf("%s/user/%d", baseURL, s.UserID),
+		published: s.Published,
+	})
+
+	if s.Published.After(f.updated) {
+		f.updated = s.Published
+	}
+}
+
+// a feed without entries has never been updated, the epoch keeps it valid
+// and the same from one request to the next
+func (f *feed) updatedOrEpoch() time.Time {
+	if f.updated.IsZero() {
+		return time.Unix(0, 0)
+	}
+
+	return f.updated
+}
+
+// https://datatracker.ietf.org/doc/html/rfc4287
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Title string `xml:"title"`
+	Subtitle string `xml:"subtitle"`
+	ID string `xml:"id"`
+	Updated string `xml:"updated"`
+	Links []atomLink `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID string `xml:"id"`
+	Link atomLink `xml:"link"`
+	Published string `xml:"published"`
+	Updated string `xml:"updated"`
+	Author atomPerson `xml:"author"`
+	Content atomText `xml:"content"`
+}
+
+func (f *feed) atom() atomFeed {
+	a := atomFeed{
+		Title: f.title,
+		Subtitle: f.description,
+		ID: f.link,
+		Updated: f.updatedOrEpoch().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.self, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, e := range f.entries {
+		// snippets can't be edited, so they're only ever updated when published
+		published := e.published.UTC().Format(time.RFC3339)
+
+		a.Entries = append(a.Entries, atomEntry{
+			Title: e.title,
+			ID: e.link,
+			Link: atomLink{Href: e.link},
+			Published: published,
+			Updated: published,
+			Author: atomPerson{Name: e.author, URI: e.authorLink},
+			Content: atomText{Type: "text", Body: e.content},
+		})
+	}
+
+	return a
+}
+
+// https://www.rssboard.org/rss-specification
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string `xml:"version,attr"`
+	AtomNS string `xml:"xmlns:atom,attr"`
+	DCNS string `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	Description string `xml:"description"`
+	LastBuildDate string `xml:"lastBuildDate"`
+	// RSS has no way of linking to the feed itself, Atom's is the usual fix
+	Self atomLink `xml:"atom:link"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool `xml:"isPermaLink,attr"`
+	Value string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	GUID rssGUID `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	// RSS's own author element has to be an email address
+	Creator string `xml:"dc:creator"`
+	Description string `xml:"description"`
+}
+
+func (f *feed) rss() rssFeed {
+	rs := rssFeed{
+		Version: "2.0",
+		AtomNS: "http://www.w3.org/2005/Atom",
+		DCNS: "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title: f.title,
+			Link: f.link,
+			Description: f.description,
+			LastBuildDate: f.updatedOrEpoch().UTC().Format(time.RFC1123Z),
+			Self: atomLink{Href: f.self, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+
+	for _, e := range f.entries {
+		rs.Channel.Items = append(rs.Channel.Items, rssItem{
+			Title: e.title,
+			Link: e.link,
+			GUID: rssGUID{IsPermaLink: true, Value: e.link},
+			PubDate: e.published.UTC().Format(time.RFC1123Z),
+			Creator: e.author,
+			// readers treat descriptions as HTML, escaped so code shows as
+			// it was written
+			Description: "<pre>" + template.HTMLEscapeString(e.content) + "</pre>",
+		})
+	}
+
+	return rs
+}
+
+// writes f in format. Feed readers poll, so the response has an ETag and a
+// Last-Modified date and is only sent again when it has changed.
+func (app *application) serveFeed(w http.ResponseWriter, r *http.Request, f feed, format string) {
+	var v any
+	var contentType string
+
+	switch format {
+	case feedFormatAtom:
+		v = f.atom()
+		contentType = "application/atom+xml; charset=utf-8"
+	case feedFormatRSS:
+		v = f.rss()
+		contentType = "application/rss+xml; charset=utf-8"
+	default:
+		app.serverError(w, r, fmt.Errorf("unknown feed format %q", format))
+		return
+	}
+
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+
+	// entries can disappear without anything newer being published, so
+	// the ETag goes by the content rather than the date
+	sum := sha256.Sum256(body)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	// handles If-None-Match and If-Modified-Since, and HEAD requests
+	http.ServeContent(w, r, "", f.updated, bytes.NewReader(body))
+}
+
+// serves the latest snippets as a feed in format
+func (app *application) latestFeed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippets, err := app.snippets.Latest()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// entries are by a handful of people at most
+		authors := make(map[int]models.User)
+		for _, s := range snippets {
+			if _, ok := authors[s.UserID]; ok {
+				continue
+			}
+
+			user, err := app.users.Get(s.UserID)
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+			authors[s.UserID] = user
+		}
+
+		f := feed{
+			title: "Snippetbox",
+			description: "The latest snippets on Snippetbox",
+			link: app.baseURL + "/",
+			self: app.baseURL + "/feed." + format,
+		}
+		for _, s := range snippets {
+			f.add(app.baseURL, s, authors[s.UserID])
+		}
+
+		app.serveFeed(w, r, f, format)
+	}
+}
+
+// serves a user's latest snippets as a feed in format, the user is looked
+// up the same way as for their profile
+func (app *application) userFeed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := app.userByRef(w, r)
+		if !ok {
+			return
+		}
+
+		snippets, err := app.snippets.ByUser(user.ID, userFeedEntries, 0)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		profile := fmt.Sprintf("%s/user/%d", app.baseURL, user.ID)
+
+		f := feed{
+			title: fmt.Sprintf("Snippets by %s", user.Name),
+			description: fmt.Sprintf("The latest snippets by %s on Snippetbox", user.Name),
+			link: profile,
+			self: fmt.Sprintf("%s/feed.%s", profile, format),
+		}
+		for _, s := range snippets {
+			f.add(app.baseURL, s, user)
+		}
+
+		app.serveFeed(w, r, f, format)
+	}
+}
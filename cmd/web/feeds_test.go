@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/models"
+)
+
+func TestFeed(t *testing.T) {
+	published := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	f := feed{
+		title: "Snippetbox",
+		link: "https://example.com/",
+		self: "https://example.com/feed.atom",
+	}
+
+	// no entries yet
+	assert.Equal(t, f.atom().Updated, "1970-01-01T00:00:00Z")
+
+	f.add("https://example.com", models.Snippet{ID: 1, UserID: 2, Title: "Escaping", Content: "if a < b && c > d {", Published: published}, models.User{Name: "Bob"})
+	f.add("https://example.com", models.Snippet{ID: 2, UserID: 3, Title: "Older", Content: "...", Published: published.Add(-time.Hour)}, models.User{})
+
+	assert.Equal(t, f.updated.Equal(published), true)
+
+	a := f.atom()
+	assert.Equal(t, a.Updated, "2024-03-17T10:15:00Z")
+	assert.Equal(t, len(a.Entries), 2)
+	assert.Equal(t, a.Entries[0].ID, "https://example.com/snippet/view/1")
+	assert.Equal(t, a.Entries[0].Author, atomPerson{Name: "Bob", URI: "https://example.com/user/2"})
+	assert.Equal(t, a.Entries[0].Content.Body, "if a < b && c > d {")
+	assert.Equal(t, a.Entries[1].Author.Name, "Unknown")
+
+	rs := f.rss()
+	assert.Equal(t, rs.Channel.LastBuildDate, "Sun, 17 Mar 2024 10:15:00 +0000")
+	assert.Equal(t, rs.Channel.Items[0].Description, "<pre>if a &lt; b &amp;&amp; c &gt; d {</pre>")
+
+	// both survive a round trip through encoding/xml
+	for _, v := range []any{a, rs} {
+		body, err := xml.Marshal(v)
+		assert.NilError(t, err)
+		assert.NilError(t, xml.Unmarshal(body, new(struct{})))
+	}
+}
+
+func TestFeedHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		urlPath string
+		wantCode int
+		wantContentType string
+		wantBody string
+	}{
+		{
+			name: "Atom",
+			urlPath: "/feed.atom",
+			wantCode: http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody: "<title>An old silent pond</title>",
+		},
+		{
+			name: "RSS",
+			urlPath: "/feed.rss",
+			wantCode: http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantBody: "<dc:creator>Alice Jones</dc:creator>",
+		},
+		{
+			name: "User by handle",
+			urlPath: "/user/alice/feed.atom",
+			wantCode: http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody: `<link href="https://localhost:4000/user/1/feed.atom" rel="self" type="application/atom+xml"></link>`,
+		},
+		{
+			name: "User by ID",
+			urlPath: "/user/1/feed.rss",
+			wantCode: http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantBody: "<title>Snippets by Alice Jones</title>",
+		},
+		{
+			name: "User without snippets",
+			urlPath: "/user/bob/feed.atom",
+			wantCode: http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody: "<updated>1970-01-01T00:00:00Z</updated>",
+		},
+		{
+			name: "No such user",
+			urlPath: "/user/nobody/feed.atom",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "Unknown format",
+			urlPath: "/feed.json",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, headers.Get("Content-Type"), tt.wantContentType)
+				assert.Equal(t, strings.HasPrefix(body, xml.Header), true)
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, headers, _ := ts.get(t, "/feed.atom")
+	etag := headers.Get("ETag")
+	lastModified := headers.Get("Last-Modified")
+	assert.Equal(t, etag != "", true)
+	assert.Equal(t, lastModified != "", true)
+
+	tests := []struct {
+		name string
+		header string
+		value string
+		wantCode int
+	}{
+		{name: "Matching ETag", header: "If-None-Match", value: etag, wantCode: http.StatusNotModified},
+		{name: "Stale ETag", header: "If-None-Match", value: `"stale"`, wantCode: http.StatusOK},
+		{name: "Not modified since", header: "If-Modified-Since", value: lastModified, wantCode: http.StatusNotModified},
+		{name: "Modified since", header: "If-Modified-Since", value: "Mon, 01 Jan 2024 00:00:00 GMT", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/feed.atom", nil)
+			assert.NilError(t, err)
+			req.Header.Set(tt.header, tt.value)
+
+			rs, err := ts.Client().Do(req)
+			assert.NilError(t, err)
+			rs.Body.Close()
+
+			assert.Equal(t, rs.StatusCode, tt.wantCode)
+		})
+	}
+}
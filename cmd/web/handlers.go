@@ -1,13 +1,23 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
 	"fmt"
-
+	"math/rand/v2"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"snippetbox.derrc/internal/mailer"
 	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/oidc"
+	"snippetbox.derrc/internal/secrets"
+	"snippetbox.derrc/internal/spam"
+	"snippetbox.derrc/internal/totp"
 	"snippetbox.derrc/internal/validator"
 )
 
@@ -31,19 +41,8 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.PathValue("id"))
-	if err != nil || id < 1 {
-		http.NotFound(w, r)
-		return
-	}
-
-	snippet, err := app.snippets.Get(id);
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			http.NotFound(w, r)
-		} else {
-			app.serverError(w, r, err)
-		}
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
 		return
 	}
 
@@ -53,22 +52,74 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "view.tmpl", data)
 }
 
+// when a snippet expires, shared by the create and expiry forms
+type expiryForm struct {
+	// days from expiryPresets, "duration", "date" or "never"
+	Expires string `form:"expires"`
+	// e.g. "90d", when Expires is "duration"
+	ExpiresIn string `form:"expires_in"`
+	// a datetime-local value in TimeZone, when Expires is "date"
+	ExpiresAt string `form:"expires_at"`
+	TimeZone string `form:"timezone"`
+}
+
 // struct tags tell decoder what HTML form values to map to what fields
 // based on 'name' attribute
 type snippetCreateForm struct {
 	Title string `form:"title"`
 	Content string `form:"content"`
-	Expires int `form:"expires"`
+	// a datetime-local value in TimeZone, empty to publish straight away
+	PublishAt string `form:"publish_at"`
+	expiryForm
+	// the autosaved draft this is being written in, deleted once it's
+	// published
+	DraftID int `form:"draft_id"`
+	// fingerprint of the secret scan findings the user has confirmed
+	AcknowledgeSecrets string `form:"acknowledge_secrets"`
 	validator.Validator `form:"-"`
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
 	// default form values
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	form := snippetCreateForm{
+		expiryForm: expiryForm{Expires: "365"},
+	}
+
+	// carrying on with a draft
+	if ref := r.URL.Query().Get("draft"); ref != "" {
+		id, err := strconv.Atoi(ref)
+		if err != nil || id < 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		draft, err := app.drafts.Get(id, userID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		form.DraftID = draft.ID
+		form.Title = draft.Title
+		form.Content = draft.Content
 	}
 
+	drafts, err := app.drafts.Count(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.DraftCount = drafts
+
 	app.render(w, r, http.StatusOK, "create.tmpl", data)
 }
 
@@ -83,11 +134,27 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = app.checkChallenge(r, challengeScopeCreate, &form.Validator)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// form validation
 	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank");
 	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.MaxBytes(form.Content, app.maxContentBytes), "content", fmt.Sprintf("This field cannot be more than %s", humanBytes(int64(app.maxContentBytes))))
+
+	now := time.Now()
+	published := parsePublishAt(form.PublishAt, form.TimeZone, now, &form.Validator)
+
+	// a scheduled snippet's expiry counts from when it's published
+	from := now
+	if !published.IsZero() {
+		from = published
+	}
+	expires := app.parseExpiry(form.expiryForm, app.currentUser(r), from, &form.Validator)
 
 	if !form.Valid() {
 		// re-display template with form data if there was a validation error
@@ -98,33 +165,136 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	usage, err := app.snippets.Usage(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if reason := app.quota.check(usage, int64(len(form.Title)+len(form.Content))); reason != "" {
+		form.AddNonFieldError(reason)
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "create.tmpl", data)
+		return
+	}
+
+	// look for credentials before anything is stored, the user has to confirm
+	// exactly these findings for the snippet to be published anyway
+	if app.secretScanner != nil {
+		findings := app.secretScanner.Scan(form.Content)
+		fingerprint := secrets.Fingerprint(findings)
+
+		if len(findings) > 0 && (app.blockSecrets || form.AcknowledgeSecrets != fingerprint) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			data.SecretScan = secretScanData{
+				Findings: findings,
+				Fingerprint: fingerprint,
+				Blocked: app.blockSecrets,
+			}
+			app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+			return
+		}
+
+		if len(findings) > 0 {
+			rules := make([]string, len(findings))
+			for i, f := range findings {
+				rules[i] = f.RuleID
+			}
+			app.logger.Warn("snippet published with likely secrets", "userID", userID, "rules", strings.Join(rules, ","))
+		}
+	}
+
+	// snippets from new accounts go through the spam filter
+	var verdict spam.Verdict
+	if app.spamPolicy.applies(app.currentUser(r)) {
+		verdict, err = app.spamFilter.Classify(spam.Content{Title: form.Title, Body: form.Content})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	held := verdict.Spam && app.spamPolicy.mode == spamModeHold
+
+	id, err := app.snippets.Insert(userID, form.Title, form.Content, published, expires, held)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	if verdict.Spam {
+		_, err = app.spam.Queue(id, verdict.Score, strings.Join(verdict.Reasons, "; "), held)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// the draft isn't needed any more, it may already have been deleted in
+	// another tab
+	if form.DraftID != 0 {
+		err = app.drafts.Delete(form.DraftID, userID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// scheduled snippets are announced by runScheduledPublisher once
+	// they're published
+	if published.IsZero() {
+		err = app.publishSnippet(models.Snippet{ID: id, UserID: userID, Title: form.Title, Created: now, Published: now, Held: held})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	// add (k,v) to session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	if held {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet created. Other users will be able to see it once a moderator has reviewed it.")
+	} else if !published.IsZero() {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet scheduled. It will be published on %s UTC.", humanDate(published)))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	}
 
 	// redirect user to page with created snippet
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// handles that would clash with fixed routes under /user/
+var reservedHandles = []string{"signup", "login", "logout", "verify", "unlock", "reauth", "trash", "scheduled", "drafts"}
+
 type userSignupForm struct {
 	Name string `form:"name"`
+	Handle string `form:"handle"`
 	Email string `form:"email"`
 	Password string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	if app.signupDisabled {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
 	app.render(w, r, http.StatusOK, "signup.tmpl", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	if app.signupDisabled {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
 	var form userSignupForm
 
 	err := app.decodePostForm(r, &form)
@@ -133,7 +303,16 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = app.checkChallenge(r, challengeScopeSignup, &form.Validator)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Handle), "handle", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Handle, validator.HandleRX), "handle", "This field must be 3-30 lowercase letters, digits or underscores, starting with a letter")
+	form.CheckField(!validator.PermittedValue(form.Handle, reservedHandles...), "handle", "This handle is not available")
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
@@ -146,12 +325,18 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	id, err := app.users.Insert(form.Name, form.Handle, form.Email, form.Password)
 	if err != nil {
-		// check for duplicate email error, else error on server-side
+		// check for duplicate email/handle error, else error on server-side
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already in use")
 
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		} else if errors.Is(err, models.ErrDuplicateHandle) {
+			form.AddFieldError("handle", "Handle is already in use")
+
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
@@ -161,14 +346,81 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	err = app.sendVerificationEmail(models.User{ID: id, Name: form.Name, Email: form.Email})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Check your email for a link to verify your address, then log in.")
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
+// number of snippets shown per page on a user's profile
+const profileSnippetsPerPage = 10
+
+// returns the user with the {ref} path value, either a numeric ID or a
+// handle, or writes a 404 if there's no such user
+func (app *application) userByRef(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	ref := r.PathValue("ref")
+
+	var user models.User
+	var err error
+
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		if id < 1 {
+			http.NotFound(w, r)
+			return models.User{}, false
+		}
+		user, err = app.users.Get(id)
+	} else {
+		user, err = app.users.GetByHandle(ref)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// shows a user's public profile, looked up by either numeric ID or handle
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userByRef(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// fetch one extra snippet to find out whether there is a next page
+	snippets, err := app.snippets.ByUser(user.ID, profileSnippetsPerPage+1, (page-1)*profileSnippetsPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.ProfileUser = user
+	data.Pagination = newPagination(page, len(snippets), profileSnippetsPerPage)
+	data.Snippets = snippets[:min(len(snippets), profileSnippetsPerPage)]
+
+	app.render(w, r, http.StatusOK, "profile.tmpl", data)
+}
+
 type userLoginForm struct {
 	Email string `form:"email"`
 	Password string `form:"password"`
+	RememberMe bool `form:"rememberMe"`
 	validator.Validator `form:"-"`
 }
 
@@ -198,30 +450,197 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// throttle by the address that was typed in, whether or not it belongs
+	// to anyone, so the responses don't give away which accounts exist
+	email := strings.ToLower(strings.TrimSpace(form.Email))
+	ip := clientIP(r)
+
+	wait, locked, err := app.loginWait(email, ip)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		err = app.loginAttempts.Record(email, ip, models.LoginEventThrottled)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if locked {
+			form.AddNonFieldError("Too many failed login attempts. This account has been locked for a while, check your email for a link to unlock it.")
+		} else {
+			form.AddNonFieldError(fmt.Sprintf("Too many failed login attempts. Please wait %s and try again.", wait.Truncate(time.Second)+time.Second))
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl", data)
+		return
+	}
+
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.recordLoginFailure(email, ip)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
 			form.AddNonFieldError("Email or password is incorrect")
 
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			form.AddNonFieldError("This account has been disabled")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "login.tmpl", data)
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	// good practice to create a new token for the current session when changing
-	// privillege levels (to prevent session-fixation attacks)
-	// retains old session data
-	err = app.sessionManager.RenewToken(r.Context())
+	app.completeLogin(w, r, id, email, form.RememberMe)
+}
+
+// how long a user has to enter their two-factor code after their password
+const twoFactorLoginTimeout = 5 * time.Minute
+
+// wrong two-factor codes allowed before the user has to start over
+const twoFactorMaxAttempts = 5
+
+type userLoginTwoFactorForm struct {
+	Code string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !app.sessionManager.Exists(r.Context(), "twoFactorUserID") {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userLoginTwoFactorForm{}
+
+	app.render(w, r, http.StatusOK, "login_2fa.tmpl", data)
+}
+
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+	started := time.Unix(app.sessionManager.GetInt64(r.Context(), "twoFactorStarted"), 0)
+
+	if id == 0 || time.Since(started) > twoFactorLoginTimeout {
+		app.clearTwoFactorLogin(r.Context())
+		app.sessionManager.Put(r.Context(), "flash", "Your login has timed out. Please log in again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form userLoginTwoFactorForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_2fa.tmpl", data)
+		return
+	}
+
+	// wrong codes count as failed logins for the account, so guessing them
+	// backs off and locks the account the same way guessing passwords does
+	email := app.sessionManager.GetString(r.Context(), "twoFactorEmail")
+	ip := clientIP(r)
+
+	wait, locked, err := app.loginWait(email, ip)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		err = app.loginAttempts.Record(email, ip, models.LoginEventThrottled)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if locked {
+			app.clearTwoFactorLogin(r.Context())
+			app.sessionManager.Put(r.Context(), "flash", "Too many failed login attempts. This account has been locked for a while, check your email for a link to unlock it.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		form.AddNonFieldError(fmt.Sprintf("Too many failed login attempts. Please wait %s and try again.", wait.Truncate(time.Second)+time.Second))
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login_2fa.tmpl", data)
+		return
+	}
+
+	ok, err := app.checkTwoFactorCode(id, form.Code)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !ok {
+		err = app.recordLoginFailure(email, ip)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= twoFactorMaxAttempts {
+			app.clearTwoFactorLogin(r.Context())
+			app.sessionManager.Put(r.Context(), "flash", "Too many incorrect codes. Please log in again.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		form.AddNonFieldError("Authentication code is incorrect")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_2fa.tmpl", data)
+		return
+	}
+
+	err = app.loginAttempts.Record(email, ip, models.LoginEventSuccess)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	rememberMe := app.sessionManager.GetBool(r.Context(), "twoFactorRememberMe")
+	app.clearTwoFactorLogin(r.Context())
+
+	err = app.loginUser(r, id, rememberMe)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
@@ -233,10 +652,2330 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.userSessions.Delete(app.sessionManager.GetString(r.Context(), "loginSessionID"), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// remove 'authenticatedUserID' from session data to logout user
 	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "loginSessionID")
+	app.sessionManager.Remove(r.Context(), "authenticatedAt")
+	app.sessionManager.Remove(r.Context(), "tokenRotatedAt")
+	app.sessionManager.Remove(r.Context(), "rememberMe")
+	app.sessionManager.RememberMe(r.Context(), false)
 
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
\ No newline at end of file
+}
+
+func (app *application) account(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	usage, err := app.snippets.Usage(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.ProfileUser = user
+	data.Quota = quotaData{
+		Usage: usage,
+		MaxSnippets: app.quota.maxSnippets,
+		MaxBytes: app.quota.maxBytes,
+	}
+
+	_, err = app.twoFactor.Secret(userID)
+	if err == nil {
+		data.TwoFactor.Enabled = true
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "account.tmpl", data)
+}
+
+type accountNameForm struct {
+	Name string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountName(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = accountNameForm{Name: user.Name}
+
+	app.render(w, r, http.StatusOK, "account_name.tmpl", data)
+}
+
+func (app *application) accountNamePost(w http.ResponseWriter, r *http.Request) {
+	var form accountNameForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_name.tmpl", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.users.UpdateName(userID, form.Name)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your name has been updated.")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+type accountEmailForm struct {
+	Email string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountEmail(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = accountEmailForm{Email: user.Email}
+
+	app.render(w, r, http.StatusOK, "account_email.tmpl", data)
+}
+
+func (app *application) accountEmailPost(w http.ResponseWriter, r *http.Request) {
+	var form accountEmailForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_email.tmpl", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.users.UpdateEmail(userID, form.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_email.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been updated. Check your inbox for a link to verify it.")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+type accountPasswordForm struct {
+	CurrentPassword string `form:"currentPassword"`
+	NewPassword string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountPassword(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordForm{}
+
+	app.render(w, r, http.StatusOK, "account_password.tmpl", data)
+}
+
+func (app *application) accountPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_password.tmpl", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.users.UpdatePassword(userID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_password.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// issue a new token for this session and log out everywhere else,
+	// so a leaked password (or session) can't be used any more
+	err = app.renewSessionToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.destroyOtherSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated.")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// how long a password reset link stays valid for
+const passwordResetTokenTTL = 30 * time.Minute
+
+type userPasswordForgotForm struct {
+	Email string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userPasswordForgotForm{}
+
+	app.render(w, r, http.StatusOK, "password_forgot.tmpl", data)
+}
+
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form userPasswordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_forgot.tmpl", data)
+		return
+	}
+
+	// only send an email if the account exists, but respond the same
+	// either way so the form can't be used to find registered addresses
+	user, err := app.users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err == nil {
+		token, err := app.tokens.New(user.ID, passwordResetTokenTTL, models.ScopePasswordReset)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sendMail(mailer.Message{
+			To: user.Email,
+			Subject: "Reset your Snippetbox password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in 30 minutes.\n\n%s/user/password/reset?token=%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+				user.Name, app.baseURL, token.Plaintext),
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If an account exists for that address, we've emailed it a link to reset the password.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type userPasswordResetForm struct {
+	Token string `form:"token"`
+	NewPassword string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := app.tokens.Check(token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userPasswordResetForm{Token: token}
+
+	app.render(w, r, http.StatusOK, "password_reset.tmpl", data)
+}
+
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form userPasswordResetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_reset.tmpl", data)
+		return
+	}
+
+	userID, err := app.tokens.Consume(form.Token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link is invalid or has expired.")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.SetPassword(userID, form.NewPassword)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// any other outstanding reset links are no longer needed
+	err = app.tokens.DeleteAllForUser(models.ScopePasswordReset, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// whoever knew the old password shouldn't stay logged in
+	err = app.destroyOtherSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// minimum time between verification emails for the same user
+const verificationResendInterval = 5 * time.Minute
+
+type userVerifyForm struct {
+	Token string `form:"token"`
+	validator.Validator `form:"-"`
+}
+
+// shows a confirmation button rather than verifying straight away, so that
+// link scanners in mail clients don't use up the token with a GET
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userVerifyForm{Token: r.URL.Query().Get("token")}
+
+	app.render(w, r, http.StatusOK, "verify.tmpl", data)
+}
+
+func (app *application) userVerifyPost(w http.ResponseWriter, r *http.Request) {
+	var form userVerifyForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.tokens.Consume(form.Token, models.ScopeEmailVerification)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.SetEmailVerified(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) accountVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified.")
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	lastSent, err := app.tokens.LastCreated(models.ScopeEmailVerification, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if time.Since(lastSent) < verificationResendInterval {
+		app.sessionManager.Put(r.Context(), "flash", "We've recently sent you a verification email. Please wait a few minutes before asking for another.")
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent you a new verification email.")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// number of recovery codes given out when two-factor is enabled
+const recoveryCodeCount = 10
+
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	data := app.newTemplateData(r)
+	data.Form = accountTwoFactorDisableForm{}
+
+	_, err := app.twoFactor.Secret(userID)
+	if err == nil {
+		data.TwoFactor.Enabled = true
+
+		data.TwoFactor.RecoveryCodesRemaining, err = app.twoFactor.RecoveryCodesRemaining(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "account_2fa.tmpl", data)
+}
+
+type accountTwoFactorSetupForm struct {
+	Code string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+// shows a new secret for the user to add to their authenticator app, the
+// secret is kept in the session until it has been confirmed with a code
+func (app *application) accountTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "totpPendingSecret")
+	if secret == "" {
+		var err error
+
+		secret, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "totpPendingSecret", secret)
+	}
+
+	data, err := app.newTwoFactorSetupData(r, secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Form = accountTwoFactorSetupForm{}
+
+	app.render(w, r, http.StatusOK, "account_2fa_setup.tmpl", data)
+}
+
+func (app *application) accountTwoFactorSetupPost(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "totpPendingSecret")
+	if secret == "" {
+		http.Redirect(w, r, "/account/2fa/setup", http.StatusSeeOther)
+		return
+	}
+
+	var form accountTwoFactorSetupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	step, ok := totp.Validate(secret, form.Code, time.Now())
+	if form.Valid() && !ok {
+		form.AddFieldError("code", "Authentication code is incorrect")
+	}
+
+	if !form.Valid() {
+		data, err := app.newTwoFactorSetupData(r, secret)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_2fa_setup.tmpl", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	recoveryCodes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.twoFactor.Enable(userID, secret, recoveryCodes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the code used to confirm setup can't be used again to log in
+	_, err = app.twoFactor.UseStep(userID, step)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "totpPendingSecret")
+
+	// recovery codes are only ever shown this once, so render them
+	// directly instead of redirecting
+	data := app.newTemplateData(r)
+	data.TwoFactor.Enabled = true
+	data.TwoFactor.RecoveryCodes = recoveryCodes
+
+	app.render(w, r, http.StatusOK, "account_2fa_codes.tmpl", data)
+}
+
+type accountTwoFactorDisableForm struct {
+	Password string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	var form accountTwoFactorDisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = app.users.Authenticate(user.Email, form.Password)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.TwoFactor.Enabled = true
+		app.render(w, r, http.StatusUnprocessableEntity, "account_2fa.tmpl", data)
+		return
+	}
+
+	err = app.twoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off.")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+type userUnlockForm struct {
+	Token string `form:"token"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userUnlock(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userUnlockForm{Token: r.URL.Query().Get("token")}
+
+	app.render(w, r, http.StatusOK, "unlock.tmpl", data)
+}
+
+func (app *application) userUnlockPost(w http.ResponseWriter, r *http.Request) {
+	var form userUnlockForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.tokens.Consume(form.Token, models.ScopeAccountUnlock)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That unlock link is invalid or has expired.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	email := strings.ToLower(user.Email)
+
+	err = app.loginAttempts.Unlock(email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// also clears the failure count, so backoff starts from scratch
+	err = app.loginAttempts.Record(email, clientIP(r), models.LoginEventUnlock)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been unlocked. Please log in.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.userSessions.ForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.CurrentSessionID = app.sessionManager.GetString(r.Context(), "loginSessionID")
+
+	app.render(w, r, http.StatusOK, "account_sessions.tmpl", data)
+}
+
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// only deletes the session if it belongs to the current user
+	err := app.userSessions.Delete(r.PathValue("id"), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The session has been logged out.")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.destroyOtherSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "All your other sessions have been logged out.")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+type userReauthForm struct {
+	Password string `form:"password"`
+	Next string `form:"next"`
+	validator.Validator `form:"-"`
+}
+
+// asks for the password again before a sensitive action
+func (app *application) userReauth(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userReauthForm{Next: r.URL.Query().Get("next")}
+
+	app.render(w, r, http.StatusOK, "reauth.tmpl", data)
+}
+
+func (app *application) userReauthPost(w http.ResponseWriter, r *http.Request) {
+	var form userReauthForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = app.users.Authenticate(user.Email, form.Password)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "reauth.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedAt", time.Now().Unix())
+
+	// only follow relative links back into the site
+	next := form.Next
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/account"
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// starts signing in with the SSO provider, the state, nonce and PKCE code
+// verifier are kept in the session so the callback can check them
+func (app *application) userLoginSSO(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := app.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// the SSO provider sends users back here after they've signed in, they're
+// logged in as the user linked to their subject ID, or the user with their
+// (verified) email address, or a new user if there's neither
+func (app *application) userLoginSSOCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	// each sign in attempt can only come back once
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+	if state == "" || query.Get("state") != state {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("error") != "" {
+		app.sessionManager.Put(r.Context(), "flash", "Signing in with SSO didn't work, please try again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	// the code can have expired or already been used, or the provider can
+	// send back a token that doesn't check out, none of which is our fault
+	claims, err := app.oidc.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+	if err != nil {
+		app.logger.Warn("SSO code exchange failed", "error", err.Error())
+		app.sessionManager.Put(r.Context(), "flash", "Signing in with SSO didn't work, please try again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash", "Your SSO account doesn't have a verified email address.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.ssoUser(claims)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateExternalID) {
+			app.sessionManager.Put(r.Context(), "flash", "Your email address belongs to an account linked to a different SSO login.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else if errors.Is(err, errUnverifiedAccount) {
+			app.sessionManager.Put(r.Context(), "flash", "An account with your email address already exists. Log in with your password and verify your email address before using SSO.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		app.sessionManager.Put(r.Context(), "flash", "This account has been disabled.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.loginAttempts.Record(strings.ToLower(claims.Email), clientIP(r), models.LoginEventSuccess)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the provider is responsible for any second factor, so users go straight in
+	err = app.loginUser(r, user.ID, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// returned by ssoUser when the account with the SSO email address hasn't
+// verified it
+var errUnverifiedAccount = errors.New("account email address not verified")
+
+// returns the user to log in for a verified SSO identity, linking or
+// creating the user as needed. Only accounts that have verified their email
+// address are linked, otherwise whoever signed up with it could log in to
+// the account with their password once it had been linked.
+func (app *application) ssoUser(claims oidc.Claims) (models.User, error) {
+	user, err := app.users.GetByExternalID(claims.Subject)
+	if err == nil {
+		return user, nil
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return models.User{}, err
+	}
+
+	user, err = app.users.GetByEmail(claims.Email)
+	if err == nil {
+		if user.ExternalID != "" {
+			return models.User{}, models.ErrDuplicateExternalID
+		}
+		if !user.EmailVerified {
+			return models.User{}, errUnverifiedAccount
+		}
+
+		return user, app.users.SetExternalID(user.ID, claims.Subject)
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return models.User{}, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	// try the handle from the email address first, then add a few random
+	// digits to it if someone already has it
+	handle := ssoHandle(claims.Email)
+	for i := 0; i < 5; i++ {
+		candidate := handle
+		if i > 0 || validator.PermittedValue(handle, reservedHandles...) {
+			candidate = fmt.Sprintf("%s_%04d", handle[:min(len(handle), 25)], rand.IntN(10000))
+		}
+
+		id, err := app.users.InsertExternal(name, candidate, claims.Email, claims.Subject)
+		if !errors.Is(err, models.ErrDuplicateHandle) {
+			return models.User{ID: id, Name: name, Handle: candidate, Email: claims.Email}, err
+		}
+	}
+
+	return models.User{}, models.ErrDuplicateHandle
+}
+
+// derives a handle that matches validator.HandleRX from an email address
+func ssoHandle(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	handle := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, local)
+
+	if handle == "" || handle[0] < 'a' || handle[0] > 'z' {
+		handle = "user_" + handle
+	}
+	for len(handle) < 3 {
+		handle += "_"
+	}
+
+	return handle[:min(len(handle), 30)]
+}
+
+// how long an emailed sign-in link can be used for
+const loginLinkTokenTTL = 15 * time.Minute
+
+// minimum time between sign-in links for the same user, so the form can't be
+// used to flood someone's inbox
+const loginLinkResendInterval = time.Minute
+
+type userLoginLinkForm struct {
+	Email string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLoginLink(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginLinkForm{}
+
+	app.render(w, r, http.StatusOK, "login_link.tmpl", data)
+}
+
+// emails a one-time sign-in link, the session keeps the token's hash so the
+// link only works in the browser that asked for it
+func (app *application) userLoginLinkPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginLinkForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_link.tmpl", data)
+		return
+	}
+
+	// only send an email if the account exists, but respond the same
+	// either way so the form can't be used to find registered addresses
+	user, err := app.users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err == nil {
+		lastSent, err := app.tokens.LastCreated(models.ScopeLoginLink, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if time.Since(lastSent) >= loginLinkResendInterval {
+			token, err := app.tokens.New(user.ID, loginLinkTokenTTL, models.ScopeLoginLink)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			app.sessionManager.Put(r.Context(), "loginLinkNonce", base64.RawURLEncoding.EncodeToString(token.Hash))
+
+			app.sendMail(mailer.Message{
+				To: user.Email,
+				Subject: "Your Snippetbox sign-in link",
+				Body: fmt.Sprintf("Hi %s,\n\nUse the link below to log in. It expires in 15 minutes and only works in the browser you asked for it in.\n\n%s/user/login/link/confirm?token=%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+					user.Name, app.baseURL, token.Plaintext),
+			})
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If an account exists for that address, we've emailed it a sign-in link.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type userLoginLinkConfirmForm struct {
+	Token string `form:"token"`
+}
+
+// asks the user to confirm, so email scanners that follow links don't use
+// the token up
+func (app *application) userLoginLinkConfirm(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginLinkConfirmForm{Token: r.URL.Query().Get("token")}
+
+	app.render(w, r, http.StatusOK, "login_link_confirm.tmpl", data)
+}
+
+func (app *application) userLoginLinkConfirmPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginLinkConfirmForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// check the link belongs to this browser before using the token up, so
+	// it still works if it was opened somewhere else first
+	hash := sha256.Sum256([]byte(form.Token))
+	nonce := app.sessionManager.GetString(r.Context(), "loginLinkNonce")
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(base64.RawURLEncoding.EncodeToString(hash[:]))) != 1 {
+		app.sessionManager.Put(r.Context(), "flash", "That sign-in link was requested from a different browser. Please open it in the browser you asked for it in.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := app.tokens.Consume(form.Token, models.ScopeLoginLink)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That sign-in link is invalid or has expired.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "loginLinkNonce")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Disabled {
+		app.sessionManager.Put(r.Context(), "flash", "This account has been disabled.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	app.completeLogin(w, r, userID, strings.ToLower(user.Email), false)
+}
+
+// number of days of snippet counts shown on the admin dashboard
+const adminCountDays = 30
+
+// number of recent audit entries and login events shown on the admin dashboard
+const adminRecentLimit = 20
+
+// number of users or snippets per page in the admin listings
+const adminPerPage = 25
+
+type adminRoleForm struct {
+	Handle string `form:"handle"`
+	Role string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+// returns the template data for the admin dashboard
+func (app *application) newAdminDashboardData(r *http.Request) (templateData, error) {
+	data := app.newTemplateData(r)
+
+	var err error
+
+	data.DailyCounts, err = app.snippets.CountsByDay(adminCountDays)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data.AuditEntries, err = app.audit.Recent(adminRecentLimit)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data.LoginEvents, err = app.loginAttempts.Recent(adminRecentLimit)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	return data, nil
+}
+
+func (app *application) admin(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newAdminDashboardData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Form = adminRoleForm{Role: models.RoleUser}
+
+	app.render(w, r, http.StatusOK, "admin.tmpl", data)
+}
+
+// gives the user with the given handle a new role
+func (app *application) adminRolePost(w http.ResponseWriter, r *http.Request) {
+	var form adminRoleForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Handle = strings.TrimPrefix(strings.TrimSpace(form.Handle), "@")
+
+	form.CheckField(validator.NotBlank(form.Handle), "handle", "This field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Role, models.Roles...), "role", "This field is invalid")
+
+	var user models.User
+	if form.Valid() {
+		user, err = app.users.GetByHandle(form.Handle)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFieldError("handle", "No user has this handle")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// stops the last admin from locking everyone out by accident
+	if form.Valid() && user.ID == app.currentUser(r).ID {
+		form.AddFieldError("handle", "You can't change your own role")
+	}
+
+	if !form.Valid() {
+		data, err := app.newAdminDashboardData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "admin.tmpl", data)
+		return
+	}
+
+	err = app.users.SetRole(user.ID, form.Role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.recordAudit(r, models.AuditUserRole, models.AuditTargetUser, user.ID, form.Role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("@%s is now a %s.", user.Handle, form.Role))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// lists users, optionally only those whose name, handle or email contains ?q=
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// fetch one extra user to find out whether there is a next page
+	users, err := app.users.List(search, adminPerPage+1, (page-1)*adminPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Search = search
+	data.Pagination = newPagination(page, len(users), adminPerPage)
+	data.Users = users[:min(len(users), adminPerPage)]
+
+	app.render(w, r, http.StatusOK, "admin_users.tmpl", data)
+}
+
+// reads the {id} path value of an admin action on a user, making sure it
+// isn't the admin themselves
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.User{}, false
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.User{}, false
+	}
+
+	if user.ID == app.currentUser(r).ID {
+		app.sessionManager.Put(r.Context(), "flash", "You can't do that to your own account.")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// disables a user and logs them out everywhere
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.users.SetDisabled(user.ID, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.userSessions.DeleteAllForUser(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.recordAudit(r, models.AuditUserDisable, models.AuditTargetUser, user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("@%s has been disabled.", user.Handle))
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.users.SetDisabled(user.ID, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.recordAudit(r, models.AuditUserEnable, models.AuditTargetUser, user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("@%s has been enabled.", user.Handle))
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// replaces a user's password with a random one, logs them out everywhere and
+// emails them a link to choose a new one
+func (app *application) adminUserResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	password, err := randomPassword()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.users.SetPassword(user.ID, password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.userSessions.DeleteAllForUser(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	token, err := app.tokens.New(user.ID, passwordResetTokenTTL, models.ScopePasswordReset)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sendMail(mailer.Message{
+		To: user.Email,
+		Subject: "Your Snippetbox password has been reset",
+		Body: fmt.Sprintf("Hi %s,\n\nAn administrator has reset your password. Use the link below to choose a new one. It expires in 30 minutes, after that you can ask for a new link from the login page.\n\n%s/user/password/reset?token=%s\n",
+			user.Name, app.baseURL, token.Plaintext),
+	})
+
+	err = app.recordAudit(r, models.AuditUserPasswordReset, models.AuditTargetUser, user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("@%s's password has been reset and they've been emailed a link to choose a new one.", user.Handle))
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// lists snippets, including expired and hidden ones, optionally only those
+// whose title or content contains ?q=
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	snippets, err := app.snippets.List(search, adminPerPage+1, (page-1)*adminPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Search = search
+	data.Pagination = newPagination(page, len(snippets), adminPerPage)
+	data.Snippets = snippets[:min(len(snippets), adminPerPage)]
+
+	app.render(w, r, http.StatusOK, "admin_snippets.tmpl", data)
+}
+
+// hides, unhides or deletes the snippet with the {id} path value
+func (app *application) adminSnippetAction(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		var flash string
+		switch action {
+		case models.AuditSnippetHide:
+			err = app.snippets.SetHidden(id, true)
+			if err == nil {
+				err = app.trainSpamFilter(id, true)
+			}
+			flash = "Snippet %d has been hidden."
+		case models.AuditSnippetUnhide:
+			err = app.snippets.SetHidden(id, false)
+			if err == nil {
+				err = app.trainSpamFilter(id, false)
+			}
+			flash = "Snippet %d is visible again."
+		case models.AuditSnippetDelete:
+			err = app.snippets.Delete(id)
+			flash = "Snippet %d has been deleted."
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		err = app.recordAudit(r, action, models.AuditTargetSnippet, id, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf(flash, id))
+
+		http.Redirect(w, r, "/admin/snippets", http.StatusSeeOther)
+	}
+}
+
+// how many snippets a user can report within reportWindow
+const (
+	reportLimit = 5
+	reportWindow = time.Hour
+)
+
+// number of reports per page in the moderation queue
+const moderationPerPage = 25
+
+type snippetReportForm struct {
+	Reason string `form:"reason"`
+	Note string `form:"note"`
+	validator.Validator `form:"-"`
+}
+
+// returns the snippet with the {id} path value, or writes a 404 if it
+// doesn't exist or is hidden from the current user
+func (app *application) visibleSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	// scheduled snippets are only visible to their author until they're
+	// published
+	user := app.currentUser(r)
+	if snippet.IsScheduled() && snippet.UserID != user.ID {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	// hidden snippets are only visible to moderators (and admins), held ones
+	// to their author as well
+	if !user.HasRole(models.RoleModerator) && (snippet.Hidden || snippet.Held && snippet.UserID != user.ID) {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+type snippetExpiryForm struct {
+	expiryForm
+	validator.Validator `form:"-"`
+}
+
+// returns the snippet for the request if the current user wrote it,
+// otherwise responds with a 404
+func (app *application) ownSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID != app.currentUser(r).ID {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+func (app *application) snippetExpiry(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetExpiryForm{expiryForm: expiryForm{Expires: "365"}}
+
+	app.render(w, r, http.StatusOK, "snippet_expiry.tmpl", data)
+}
+
+func (app *application) snippetExpiryPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetExpiryForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// a scheduled snippet's expiry counts from when it's published
+	from := time.Now()
+	if snippet.IsScheduled() {
+		from = snippet.Published
+	}
+
+	user := app.currentUser(r)
+	expires := app.parseExpiry(form.expiryForm, user, from, &form.Validator)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "snippet_expiry.tmpl", data)
+		return
+	}
+
+	err = app.snippets.SetExpires(snippet.ID, expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if expires.IsZero() {
+		app.sessionManager.Put(r.Context(), "flash", "This snippet will no longer expire.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("This snippet will now expire on %s UTC.", humanDate(expires)))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// moves one of the current user's snippets to their trash
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Trash(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%q has been moved to your trash.", snippet.Title))
+
+	http.Redirect(w, r, "/user/trash", http.StatusSeeOther)
+}
+
+// number of snippets per page in the trash
+const trashSnippetsPerPage = 25
+
+func (app *application) userTrash(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// fetch one extra snippet to find out whether there is a next page
+	snippets, err := app.snippets.Trashed(userID, trashSnippetsPerPage+1, (page-1)*trashSnippetsPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = newPagination(page, len(snippets), trashSnippetsPerPage)
+	data.Snippets = snippets[:min(len(snippets), trashSnippetsPerPage)]
+	data.TrashRetentionDays = int(app.purgePolicy.trashRetention.Hours() / 24)
+
+	app.render(w, r, http.StatusOK, "trash.tmpl", data)
+}
+
+func (app *application) userTrashRestorePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.Restore(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet restored.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) userTrashDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.DeleteTrashed(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted for good.")
+
+	http.Redirect(w, r, "/user/trash", http.StatusSeeOther)
+}
+
+// number of snippets per page in the list of scheduled ones
+const scheduledSnippetsPerPage = 25
+
+// lists the current user's snippets that haven't been published yet
+func (app *application) userScheduled(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// fetch one extra snippet to find out whether there is a next page
+	snippets, err := app.snippets.Scheduled(userID, scheduledSnippetsPerPage+1, (page-1)*scheduledSnippetsPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = newPagination(page, len(snippets), scheduledSnippetsPerPage)
+	data.Snippets = snippets[:min(len(snippets), scheduledSnippetsPerPage)]
+
+	app.render(w, r, http.StatusOK, "scheduled.tmpl", data)
+}
+
+type snippetScheduleForm struct {
+	// a datetime-local value in TimeZone
+	PublishAt string `form:"publish_at"`
+	TimeZone string `form:"timezone"`
+	// publish straight away instead
+	PublishNow bool `form:"publish_now"`
+	validator.Validator `form:"-"`
+}
+
+// returns the current user's snippet for the request if it hasn't been
+// published yet, otherwise responds with a 404
+func (app *application) scheduledSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if !snippet.IsScheduled() {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+func (app *application) snippetSchedule(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.scheduledSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetScheduleForm{}
+
+	app.render(w, r, http.StatusOK, "snippet_schedule.tmpl", data)
+}
+
+// reschedules a snippet or publishes it straight away
+func (app *application) snippetSchedulePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.scheduledSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetScheduleForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var published time.Time
+	if !form.PublishNow {
+		form.CheckField(validator.NotBlank(form.PublishAt), "publish_at", "This field cannot be blank")
+		published = parsePublishAt(form.PublishAt, form.TimeZone, time.Now(), &form.Validator)
+
+		// it would never be seen
+		if !snippet.Expires.IsZero() && !published.IsZero() {
+			form.CheckField(validator.Before(published, snippet.Expires), "publish_at", fmt.Sprintf("This must be before the snippet expires on %s", humanDate(snippet.Expires)))
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "snippet_schedule.tmpl", data)
+		return
+	}
+
+	err = app.snippets.SetPublished(snippet.ID, snippet.UserID, published)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if published.IsZero() {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet published!")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("This snippet will now be published on %s UTC.", humanDate(published)))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// most drafts a user can have, autosaving a new one fails beyond this
+const maxDrafts = 50
+
+// number of drafts per page in the list of drafts
+const draftsPerPage = 25
+
+// what the create form's script sends to autosave a draft, ID is zero until
+// the draft has been saved once
+type draftInput struct {
+	ID int `json:"id"`
+	Title string `json:"title"`
+	Content string `json:"content"`
+}
+
+// autosaves a draft from the create form and responds with its ID as JSON.
+// Like any other POST, it needs the CSRF token, sent in the X-CSRF-Token
+// header.
+func (app *application) userDraftSavePost(w http.ResponseWriter, r *http.Request) {
+	var input draftInput
+
+	err := app.decodeJSON(r, &input)
+	if err != nil {
+		app.errorJSON(w, r, http.StatusBadRequest, "The request body must be a JSON draft")
+		return
+	}
+
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(input.Title) || validator.NotBlank(input.Content), "content", "There's nothing to save")
+	v.CheckField(validator.MaxChars(input.Title, 255), "title", "This field cannot be more than 255 characters long")
+	v.CheckField(validator.MaxBytes(input.Content, app.maxContentBytes), "content", fmt.Sprintf("This field cannot be more than %s", humanBytes(int64(app.maxContentBytes))))
+
+	if !v.Valid() {
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": v.FieldErrors})
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if input.ID == 0 {
+		n, err := app.drafts.Count(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if n >= maxDrafts {
+			app.errorJSON(w, r, http.StatusTooManyRequests, fmt.Sprintf("You can't have more than %d drafts. Delete some on your drafts page.", maxDrafts))
+			return
+		}
+
+		input.ID, err = app.drafts.Insert(userID, input.Title, input.Content)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		err = app.drafts.Update(input.ID, userID, input.Title, input.Content)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.errorJSON(w, r, http.StatusNotFound, "This draft has been deleted")
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"id": input.ID, "saved": time.Now().UTC()})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// lists the current user's drafts
+func (app *application) userDrafts(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// fetch one extra draft to find out whether there is a next page
+	drafts, err := app.drafts.ByUser(userID, draftsPerPage+1, (page-1)*draftsPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = newPagination(page, len(drafts), draftsPerPage)
+	data.Drafts = drafts[:min(len(drafts), draftsPerPage)]
+
+	app.render(w, r, http.StatusOK, "drafts.tmpl", data)
+}
+
+func (app *application) userDraftDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.drafts.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Draft deleted.")
+
+	http.Redirect(w, r, "/user/drafts", http.StatusSeeOther)
+}
+
+func (app *application) snippetReport(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetReportForm{}
+
+	app.render(w, r, http.StatusOK, "report.tmpl", data)
+}
+
+// adds a report about a snippet to the moderation queue
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetReportForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Reason, models.ReportReasons...), "reason", "Please choose a reason")
+	form.CheckField(validator.MaxChars(form.Note, 1000), "note", "This field cannot be more than 1000 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "report.tmpl", data)
+		return
+	}
+
+	reporterID := app.currentUser(r).ID
+
+	already, err := app.reports.HasOpen(snippet.ID, reporterID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if already {
+		app.sessionManager.Put(r.Context(), "flash", "You've already reported this snippet, a moderator will take a look.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return
+	}
+
+	count, err := app.reports.CountSince(reporterID, time.Now().Add(-reportWindow))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if count >= reportLimit {
+		form.AddNonFieldError("You've sent a lot of reports recently. Please try again later.")
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(reportWindow.Seconds())))
+
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "report.tmpl", data)
+		return
+	}
+
+	_, err = app.reports.Insert(snippet.ID, reporterID, form.Reason, form.Note)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for your report, a moderator will take a look.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// shows open reports, oldest first
+func (app *application) moderation(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reports, err := app.reports.Open(moderationPerPage+1, (page-1)*moderationPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = newPagination(page, len(reports), moderationPerPage)
+	data.Reports = reports[:min(len(reports), moderationPerPage)]
+
+	app.render(w, r, http.StatusOK, "moderation.tmpl", data)
+}
+
+// returns the open report with the {id} path value, or responds and returns
+// false if there isn't one
+func (app *application) openReport(w http.ResponseWriter, r *http.Request) (models.Report, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Report{}, false
+	}
+
+	report, err := app.reports.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Report{}, false
+	}
+
+	// another moderator may have got there first
+	if report.Status != models.ReportStatusOpen {
+		app.sessionManager.Put(r.Context(), "flash", "That report has already been handled.")
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return models.Report{}, false
+	}
+
+	return report, true
+}
+
+func (app *application) moderationDismissPost(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.reports.Resolve(report.ID, app.currentUser(r).ID, models.ReportStatusDismissed)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.trainSpamFilter(report.SnippetID, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.recordAudit(r, models.AuditReportDismiss, models.AuditTargetSnippet, report.SnippetID, fmt.Sprintf("report #%d", report.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Report dismissed.")
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// hides the reported snippet and closes every report about it
+func (app *application) hideReportedSnippet(r *http.Request, report models.Report) error {
+	err := app.snippets.SetHidden(report.SnippetID, true)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return err
+	}
+
+	err = app.reports.ResolveAllForSnippet(report.SnippetID, app.currentUser(r).ID, models.ReportStatusActioned)
+	if err != nil {
+		return err
+	}
+
+	err = app.trainSpamFilter(report.SnippetID, true)
+	if err != nil {
+		return err
+	}
+
+	return app.recordAudit(r, models.AuditSnippetHide, models.AuditTargetSnippet, report.SnippetID, fmt.Sprintf("report #%d", report.ID))
+}
+
+func (app *application) moderationHidePost(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.hideReportedSnippet(r, report)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %d has been hidden.", report.SnippetID))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// disables the author of the reported snippet, logs them out everywhere and
+// hides the snippet
+func (app *application) moderationBanPost(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	author, err := app.users.Get(report.SnippetUserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// staff accounts can only be disabled by an admin, from the admin pages
+	if author.HasRole(models.RoleModerator) {
+		app.sessionManager.Put(r.Context(), "flash", "Moderators and admins can't be banned from the moderation queue.")
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.SetDisabled(author.ID, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.userSessions.DeleteAllForUser(author.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.recordAudit(r, models.AuditUserDisable, models.AuditTargetUser, author.ID, fmt.Sprintf("report #%d", report.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.hideReportedSnippet(r, report)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("@%s has been banned and snippet %d hidden.", author.Handle, report.SnippetID))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// teaches the spam classifier from a moderator's decision to hide a snippet
+// or leave it up, snippets that have expired or been deleted since are
+// skipped
+func (app *application) trainSpamFilter(snippetID int, isSpam bool) error {
+	snippet, err := app.snippets.Get(snippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	return app.spam.Train(spam.Tokenize(spam.Content{Title: snippet.Title, Body: snippet.Content}), isSpam)
+}
+
+func (app *application) moderationSpam(w http.ResponseWriter, r *http.Request) {
+	page, err := readPage(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := app.spam.Pending(moderationPerPage+1, (page-1)*moderationPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = newPagination(page, len(reviews), moderationPerPage)
+	data.SpamReviews = reviews[:min(len(reviews), moderationPerPage)]
+
+	app.render(w, r, http.StatusOK, "moderation_spam.tmpl", data)
+}
+
+// returns a handler that records a moderator's decision (models.SpamDecision*)
+// about a snippet in the spam queue and trains the classifier with it. Spam
+// is hidden, snippets that aren't spam are released if they were held.
+func (app *application) moderationSpamDecision(decision string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		review, err := app.spam.GetReview(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// resolving first means two moderators can't both train on it
+		err = app.spam.Resolve(review.ID, app.currentUser(r).ID, decision)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.sessionManager.Put(r.Context(), "flash", "That snippet has already been reviewed.")
+				http.Redirect(w, r, "/moderation/spam", http.StatusSeeOther)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		snippet, err := app.snippets.Get(review.SnippetID)
+		if err != nil {
+			// it has expired or been deleted since, there's nothing left to do
+			if errors.Is(err, models.ErrNoRecord) {
+				app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %d no longer exists.", review.SnippetID))
+				http.Redirect(w, r, "/moderation/spam", http.StatusSeeOther)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		isSpam := decision == models.SpamDecisionSpam
+
+		err = app.spam.Train(spam.Tokenize(spam.Content{Title: snippet.Title, Body: snippet.Content}), isSpam)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		details := fmt.Sprintf("spam review #%d", review.ID)
+
+		switch {
+		case isSpam:
+			err = app.snippets.SetHidden(snippet.ID, true)
+			if err == nil {
+				err = app.recordAudit(r, models.AuditSnippetHide, models.AuditTargetSnippet, snippet.ID, details)
+			}
+			app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %d has been marked as spam and hidden.", snippet.ID))
+		case snippet.Held:
+			err = app.snippets.SetHeld(snippet.ID, false)
+			if err == nil {
+				err = app.recordAudit(r, models.AuditSnippetRelease, models.AuditTargetSnippet, snippet.ID, details)
+			}
+			// it's public from now on, scheduled snippets are announced by
+			// the scheduled publisher when their time comes
+			if err == nil && !snippet.IsScheduled() {
+				snippet.Held = false
+				err = app.publishSnippet(snippet)
+			}
+			app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %d has been marked as not spam and released.", snippet.ID))
+		default:
+			app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %d has been marked as not spam.", snippet.ID))
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, "/moderation/spam", http.StatusSeeOther)
+	}
+}
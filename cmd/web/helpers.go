@@ -2,11 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"snippetbox.derrc/internal/mailer"
+	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/pow"
+	"snippetbox.derrc/internal/ratelimit"
+	"snippetbox.derrc/internal/totp"
+	"snippetbox.derrc/internal/validator"
+
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
 )
@@ -33,6 +52,17 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 		return
 	}
 
+	// forms that need proof of work get a fresh challenge every time they're
+	// shown, the last one may have been used
+	if scope, ok := challengeScopes[page]; ok && app.pow != nil {
+		var err error
+		data.Challenge, err = app.pow.Issue(scope, time.Now())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	// initialize buffer to write to instead of response body
 	buf := new(bytes.Buffer)
 
@@ -53,7 +83,11 @@ func (app *application) newTemplateData(r *http.Request) templateData {
 		CurrentYear: time.Now().Year(),
 		Flash: app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		CurrentUser: app.currentUser(r),
 		CSRFToken: nosurf.Token(r),
+		SSOEnabled: app.oidc != nil,
+		SignupEnabled: !app.signupDisabled,
+		AllowNeverExpire: app.expiryPolicy.allowsNever(app.currentUser(r)),
 	}
 }
 
@@ -82,6 +116,46 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// decodes a JSON request body into dst, anything but a single object with
+// known fields is an error
+func (app *application) decodeJSON(r *http.Request, dst any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// writes data as a JSON response with the given status
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// writes a JSON error response, for endpoints that scripts talk to
+func (app *application) errorJSON(w http.ResponseWriter, r *http.Request, status int, message string) {
+	err := app.writeJSON(w, status, map[string]string{"error": message})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	// type assertion to expected type for value
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
@@ -91,4 +165,712 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 
 	return isAuthenticated
-}
\ No newline at end of file
+}
+
+// returns the logged in user, or the zero User if the request isn't authenticated
+func (app *application) currentUser(r *http.Request) models.User {
+	user, ok := r.Context().Value(currentUserContextKey).(models.User)
+	if !ok {
+		return models.User{}
+	}
+
+	return user
+}
+
+// revokes every login session belonging to userID except the one in ctx,
+// authenticate() logs them out on their next request
+func (app *application) destroyOtherSessions(ctx context.Context, userID int) error {
+	return app.userSessions.DeleteAllForUser(userID, app.sessionManager.GetString(ctx, "loginSessionID"))
+}
+
+// runs fn in a background goroutine, recovering (and logging) any panic
+// so it can't bring down the whole server
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// sends an email in the background, logging (rather than returning) any error
+// so that response times don't depend on the mail server
+func (app *application) sendMail(msg mailer.Message) {
+	app.background(func() {
+		err := app.mailer.Send(msg)
+		if err != nil {
+			app.logger.Error(err.Error(), "to", msg.To, "subject", msg.Subject)
+		}
+	})
+}
+
+// how long an email verification link stays valid for
+const emailVerificationTokenTTL = 3 * 24 * time.Hour
+
+// emails a user a fresh verification link, replacing any earlier ones so
+// that a link sent to a previous address can't verify the current one
+func (app *application) sendVerificationEmail(user models.User) error {
+	err := app.tokens.DeleteAllForUser(models.ScopeEmailVerification, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.tokens.New(user.ID, emailVerificationTokenTTL, models.ScopeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	app.sendMail(mailer.Message{
+		To: user.Email,
+		Subject: "Verify your Snippetbox email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by visiting the link below. It expires in 3 days.\n\n%s/user/verify?token=%s\n",
+			user.Name, app.baseURL, token.Plaintext),
+	})
+
+	return nil
+}
+
+// lifetimes of login sessions
+type sessionPolicy struct {
+	// absolute lifetime of a normal login
+	lifetime time.Duration
+	// absolute lifetime of a "remember me" login
+	rememberLifetime time.Duration
+	// how often "remember me" sessions get a new token
+	rotateEvery time.Duration
+	// how long after logging in sensitive actions need the password again
+	reauthAfter time.Duration
+}
+
+// finishes logging in a user whose identity has been checked (password or
+// emailed link), users with two-factor enabled have to enter a code before
+// they're logged in, so only remember who they are for now. The login only
+// counts as a success once it's complete, until then failed logins for email
+// still count towards its backoff and lockout.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, userID int, email string, rememberMe bool) {
+	_, err := app.twoFactor.Secret(userID)
+	if err == nil {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "twoFactorUserID", userID)
+		app.sessionManager.Put(r.Context(), "twoFactorEmail", email)
+		app.sessionManager.Put(r.Context(), "twoFactorStarted", time.Now().Unix())
+		app.sessionManager.Put(r.Context(), "twoFactorRememberMe", rememberMe)
+		app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.loginAttempts.Record(email, clientIP(r), models.LoginEventSuccess)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.loginUser(r, userID, rememberMe)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// logs the session in as userID, recording where it was logged in from
+// so the user can see (and revoke) it later
+func (app *application) loginUser(r *http.Request, userID int, rememberMe bool) error {
+	ctx := r.Context()
+
+	// good practice to create a new token for the current session when changing
+	// privillege levels (to prevent session-fixation attacks)
+	// retains old session data
+	err := app.sessionManager.RenewToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := app.userSessions.Insert(userID, clientIP(r), r.UserAgent())
+	if err != nil {
+		return err
+	}
+
+	// "remember me" sessions last longer and keep their cookie when the
+	// browser is closed, they still expire if they go unused (IdleTimeout)
+	if rememberMe {
+		app.sessionManager.SetDeadline(ctx, time.Now().Add(app.sessionPolicy.rememberLifetime))
+	} else {
+		app.sessionManager.SetDeadline(ctx, time.Now().Add(app.sessionPolicy.lifetime))
+	}
+	app.sessionManager.RememberMe(ctx, rememberMe)
+	app.sessionManager.Put(ctx, "rememberMe", rememberMe)
+
+	now := time.Now().Unix()
+	app.sessionManager.Put(ctx, "authenticatedAt", now)
+	app.sessionManager.Put(ctx, "tokenRotatedAt", now)
+
+	app.sessionManager.Put(ctx, "loginSessionID", sessionID)
+	app.sessionManager.Put(ctx, "authenticatedUserID", userID)
+	return nil
+}
+
+// gives the session a new token without shortening a "remember me" session
+// (RenewToken on its own resets the deadline to the normal lifetime)
+func (app *application) renewSessionToken(ctx context.Context) error {
+	deadline := app.sessionManager.Deadline(ctx)
+
+	err := app.sessionManager.RenewToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	if app.sessionManager.GetBool(ctx, "rememberMe") {
+		app.sessionManager.SetDeadline(ctx, deadline)
+	}
+	app.sessionManager.Put(ctx, "tokenRotatedAt", time.Now().Unix())
+
+	return nil
+}
+
+// returns whether the user logged in (or re-entered their password)
+// recently enough to be trusted with sensitive actions
+func (app *application) recentlyAuthenticated(ctx context.Context) bool {
+	authenticatedAt := time.Unix(app.sessionManager.GetInt64(ctx, "authenticatedAt"), 0)
+	return time.Since(authenticatedAt) < app.sessionPolicy.reauthAfter
+}
+
+// forgets a half-finished two-factor login
+func (app *application) clearTwoFactorLogin(ctx context.Context) {
+	app.sessionManager.Remove(ctx, "twoFactorUserID")
+	app.sessionManager.Remove(ctx, "twoFactorEmail")
+	app.sessionManager.Remove(ctx, "twoFactorStarted")
+	app.sessionManager.Remove(ctx, "twoFactorAttempts")
+	app.sessionManager.Remove(ctx, "twoFactorRememberMe")
+}
+
+// checks a code from an authenticator app, or failing that a recovery code,
+// each can only be used once
+func (app *application) checkTwoFactorCode(userID int, code string) (bool, error) {
+	secret, err := app.twoFactor.Secret(userID)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if ok {
+		return app.twoFactor.UseStep(userID, step)
+	}
+
+	return app.twoFactor.UseRecoveryCode(userID, normalizeRecoveryCode(code))
+}
+
+// returns n random recovery codes, 50 bits each
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	}
+
+	return codes, nil
+}
+
+// recovery codes are case-insensitive and may be typed with spaces or dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// template data for the two-factor setup page showing secret
+func (app *application) newTwoFactorSetupData(r *http.Request, secret string) (templateData, error) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data := app.newTemplateData(r)
+	data.TwoFactor.Secret = secret
+	data.TwoFactor.URI = template.URL(totp.URI(secret, "Snippetbox", user.Email))
+
+	return data, nil
+}
+
+// how the spam filter is applied to new snippets
+type spamPolicy struct {
+	// spamModeOff, spamModeShadow or spamModeHold
+	mode string
+	// snippets from accounts younger than this are checked
+	newAccountAge time.Duration
+}
+
+const (
+	spamModeOff = "off"
+	// suspected spam is queued for review but published as normal, to see
+	// how the filter does before trusting it
+	spamModeShadow = "shadow"
+	// suspected spam is held back from other users until it's been reviewed
+	spamModeHold = "hold"
+)
+
+// reports whether snippets by u go through the spam filter, staff are trusted
+func (p spamPolicy) applies(u models.User) bool {
+	if p.mode == spamModeOff || u.HasRole(models.RoleModerator) {
+		return false
+	}
+
+	return time.Since(u.Created) < p.newAccountAge
+}
+
+// what requests are counted together by a rate limit policy
+const (
+	rateLimitByIP = "ip"
+	// the logged in user, or the IP for anonymous requests
+	rateLimitByUser = "user"
+	// the bearer token in the Authorization header, or as rateLimitByUser
+	// without one. Anyone can make up tokens, so only use this on routes
+	// that have already rejected invalid ones.
+	rateLimitByToken = "token"
+)
+
+// a rate limit for a group of routes
+type rateLimitPolicy struct {
+	// routes with the same policy name share their buckets
+	name string
+	limit ratelimit.Limit
+	keyBy string
+}
+
+type rateLimitPolicies struct {
+	// every dynamic route
+	general rateLimitPolicy
+	// logging in (in any way), password resets and reauthentication
+	auth rateLimitPolicy
+	signup rateLimitPolicy
+	// creating snippets
+	create rateLimitPolicy
+}
+
+var defaultRateLimitPolicies = rateLimitPolicies{
+	general: rateLimitPolicy{
+		name: "general",
+		limit: ratelimit.Limit{Burst: 300, Period: time.Minute},
+		keyBy: rateLimitByUser,
+	},
+	auth: rateLimitPolicy{
+		name: "auth",
+		limit: ratelimit.Limit{Burst: 10, Period: time.Minute},
+		keyBy: rateLimitByIP,
+	},
+	signup: rateLimitPolicy{
+		name: "signup",
+		limit: ratelimit.Limit{Burst: 5, Period: time.Hour},
+		keyBy: rateLimitByIP,
+	},
+	create: rateLimitPolicy{
+		name: "create",
+		limit: ratelimit.Limit{Burst: 30, Period: time.Hour},
+		keyBy: rateLimitByUser,
+	},
+}
+
+// returns the key of r's bucket under policy p
+func (app *application) rateLimitKey(r *http.Request, p rateLimitPolicy) string {
+	switch p.keyBy {
+	case rateLimitByToken:
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			// no need to keep the token itself around
+			sum := sha256.Sum256([]byte(token))
+			return p.name + ":token:" + hex.EncodeToString(sum[:])
+		}
+		fallthrough
+	case rateLimitByUser:
+		if id := app.currentUser(r).ID; id != 0 {
+			return p.name + ":user:" + strconv.Itoa(id)
+		}
+	}
+
+	return p.name + ":ip:" + clientIP(r)
+}
+
+// how long snippets can be kept
+type expiryPolicy struct {
+	// furthest in the future an expiry can be
+	max time.Duration
+	// lowest role allowed snippets that never expire, "" if nobody is
+	neverRole string
+}
+
+func (p expiryPolicy) allowsNever(u models.User) bool {
+	return p.neverRole != "" && u.HasRole(p.neverRole)
+}
+
+// expiry presets, in days
+var expiryPresets = []string{"1", "7", "30", "365"}
+
+// parses a duration like "90d", "2w" or "36h", Go durations are accepted too
+func parseExpiryDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		// "0s" parses, but a snippet can't expire as soon as it's created
+		if d <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return d, nil
+	}
+
+	// small enough not to overflow, far beyond any sensible expiry
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 1 || n > 100000 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+var errUnknownTimeZone = errors.New("unknown timezone")
+
+// parses a datetime-local form value in the named timezone. The browser
+// fills the timezone in, without JavaScript it's empty and means UTC.
+func parseLocalTime(value, timezone string) (time.Time, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, errUnknownTimeZone
+		}
+	}
+
+	return time.ParseInLocation("2006-01-02T15:04", value, loc)
+}
+
+// works out when a snippet should expire from the form, the zero time
+// meaning never. Durations count from from, which is now unless the snippet
+// is scheduled to be published later. Anything wrong, including going
+// against the policy for the user's role, is added to v as an error for the
+// "expires" field.
+func (app *application) parseExpiry(f expiryForm, u models.User, from time.Time, v *validator.Validator) time.Time {
+	var expires time.Time
+
+	switch {
+	case validator.PermittedValue(f.Expires, expiryPresets...):
+		days, _ := strconv.Atoi(f.Expires)
+		expires = from.AddDate(0, 0, days)
+	case f.Expires == "duration":
+		d, err := parseExpiryDuration(f.ExpiresIn)
+		if err != nil {
+			v.AddFieldError("expires", "Enter a duration like 90d, 2w or 36h")
+			return time.Time{}
+		}
+		expires = from.Add(d)
+	case f.Expires == "date":
+		t, err := parseLocalTime(f.ExpiresAt, f.TimeZone)
+		if errors.Is(err, errUnknownTimeZone) {
+			v.AddFieldError("expires", "Unknown timezone")
+			return time.Time{}
+		} else if err != nil {
+			v.AddFieldError("expires", "Enter a date and time")
+			return time.Time{}
+		}
+		expires = t
+	case f.Expires == "never":
+		v.CheckField(app.expiryPolicy.allowsNever(u), "expires", "You can't create snippets that never expire")
+		return time.Time{}
+	default:
+		v.AddFieldError("expires", "This field must be one of the options")
+		return time.Time{}
+	}
+
+	// expiring at from would mean the snippet was stored already expired
+	max := from.Add(app.expiryPolicy.max)
+	message := fmt.Sprintf("This must be in the future and no later than %s", humanDate(max))
+	v.CheckField(validator.After(expires, from), "expires", message)
+	v.CheckField(validator.Between(expires, from, max), "expires", message)
+
+	return expires
+}
+
+// furthest ahead a snippet can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// parses when a snippet should be published from a datetime-local value in
+// timezone, the zero time if value is empty and it should be published
+// straight away. Anything wrong is added to v as an error for the
+// "publish_at" field.
+func parsePublishAt(value, timezone string, now time.Time, v *validator.Validator) time.Time {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}
+	}
+
+	t, err := parseLocalTime(value, timezone)
+	if errors.Is(err, errUnknownTimeZone) {
+		v.AddFieldError("publish_at", "Unknown timezone")
+		return time.Time{}
+	} else if err != nil {
+		v.AddFieldError("publish_at", "Enter a date and time")
+		return time.Time{}
+	}
+
+	max := now.Add(maxScheduleAhead)
+	v.CheckField(validator.Between(t, now, max), "publish_at", fmt.Sprintf("This must be in the future and no later than %s", humanDate(max)))
+
+	return t
+}
+
+// limits on what each user can store, zero means no limit
+type quotaPolicy struct {
+	maxSnippets int
+	maxBytes int64
+}
+
+// returns why a new snippet of size bytes would go over the quota, "" if it
+// wouldn't
+func (p quotaPolicy) check(u models.SnippetUsage, size int64) string {
+	if p.maxSnippets > 0 && u.Count >= p.maxSnippets {
+		return fmt.Sprintf("You've reached your limit of %d snippets. Delete some and empty your trash, or wait for them to expire, then try again.", p.maxSnippets)
+	}
+
+	if p.maxBytes > 0 && u.Bytes+size > p.maxBytes {
+		return fmt.Sprintf("This snippet would take you over your storage limit of %s. You're using %s.", humanBytes(p.maxBytes), humanBytes(u.Bytes))
+	}
+
+	return ""
+}
+
+// proof-of-work challenge scopes, a challenge solved for one form can't be
+// used on another
+const (
+	challengeScopeSignup = "signup"
+	challengeScopeCreate = "create"
+)
+
+// pages with forms that need proof of work, and the scope of their challenge
+var challengeScopes = map[string]string{
+	"signup.tmpl": challengeScopeSignup,
+	"create.tmpl": challengeScopeCreate,
+}
+
+// checks the proof of work sent with a form, the form gets an error if it's
+// missing, wrong or has been used before. Only failing to record the
+// challenge as used is returned as an error.
+func (app *application) checkChallenge(r *http.Request, scope string, v *validator.Validator) error {
+	if app.pow == nil {
+		return nil
+	}
+
+	err := app.pow.Verify(r.Context(), scope, r.PostForm.Get("pow_challenge"), r.PostForm.Get("pow_nonce"), time.Now())
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pow.ErrExpired):
+		v.AddNonFieldError("This form has expired. Please check it and submit it again.")
+	case errors.Is(err, pow.ErrInvalid), errors.Is(err, pow.ErrInsufficientWork), errors.Is(err, pow.ErrUsed):
+		v.AddNonFieldError("Your browser didn't finish the anti-spam check. Make sure JavaScript is enabled, wait a moment and submit the form again.")
+	default:
+		return err
+	}
+
+	return nil
+}
+
+// limits applied to failed logins, per account (email address) and per IP
+type loginPolicy struct {
+	// how far back failures are counted
+	window time.Duration
+	// failures allowed for an account before each attempt is delayed
+	backoffAfter int
+	// failures allowed from one IP, across all accounts, before it is delayed
+	ipBackoffAfter int
+	// delay once backoff starts, doubling with every further failure
+	baseDelay time.Duration
+	maxDelay time.Duration
+	// failures before an account is locked and emailed an unlock link
+	lockoutAfter int
+	lockoutDuration time.Duration
+}
+
+var defaultLoginPolicy = loginPolicy{
+	window: 15 * time.Minute,
+	backoffAfter: 3,
+	ipBackoffAfter: 30,
+	baseDelay: time.Second,
+	maxDelay: 5 * time.Minute,
+	lockoutAfter: 10,
+	lockoutDuration: 30 * time.Minute,
+}
+
+// returns how long to wait after the last of n failures
+func (p loginPolicy) delay(failures, allowed int) time.Duration {
+	if failures < allowed {
+		return 0
+	}
+
+	d := p.baseDelay
+	for i := allowed; i < failures && d < p.maxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, p.maxDelay)
+}
+
+// returns how much longer a login for email from ip has to wait, and whether
+// that's because the account is locked rather than just backing off
+func (app *application) loginWait(email, ip string) (time.Duration, bool, error) {
+	lockedUntil, err := app.loginAttempts.LockedUntil(email)
+	if err != nil {
+		return 0, false, err
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		return wait, true, nil
+	}
+
+	f, err := app.loginAttempts.Failures(email, ip, time.Now().Add(-app.loginPolicy.window))
+	if err != nil {
+		return 0, false, err
+	}
+
+	wait := time.Until(f.LastEmail.Add(app.loginPolicy.delay(f.Email, app.loginPolicy.backoffAfter)))
+	ipWait := time.Until(f.LastIP.Add(app.loginPolicy.delay(f.IP, app.loginPolicy.ipBackoffAfter)))
+
+	return max(wait, ipWait, 0), false, nil
+}
+
+// records a failed login and locks the account if it has had too many,
+// emailing the owner (if there is one) a link to unlock it
+func (app *application) recordLoginFailure(email, ip string) error {
+	err := app.loginAttempts.Record(email, ip, models.LoginEventFailure)
+	if err != nil {
+		return err
+	}
+
+	f, err := app.loginAttempts.Failures(email, ip, time.Now().Add(-app.loginPolicy.window))
+	if err != nil {
+		return err
+	}
+	if f.Email < app.loginPolicy.lockoutAfter {
+		return nil
+	}
+
+	err = app.loginAttempts.Lock(email, time.Now().Add(app.loginPolicy.lockoutDuration))
+	if err != nil {
+		return err
+	}
+
+	err = app.loginAttempts.Record(email, ip, models.LoginEventLockout)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Warn("account locked after failed logins", "email", email, "ip", ip, "failures", f.Email)
+
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := app.tokens.New(user.ID, app.loginPolicy.lockoutDuration, models.ScopeAccountUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.sendMail(mailer.Message{
+		To: user.Email,
+		Subject: "Your Snippetbox account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nThere have been several failed attempts to log in to your account, so we've locked it for a while. If this was you, you can unlock it straight away with the link below.\n\n%s/user/unlock?token=%s\n\nIf it wasn't you, your password has not been changed and your account is safe. You may want to turn on two-factor authentication.\n",
+			user.Name, app.baseURL, token.Plaintext),
+	})
+
+	return nil
+}
+
+// returns the IP address of the client that made the request
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// returns the page number from the query string, 1 if there isn't one
+func readPage(r *http.Request) (int, error) {
+	p := r.URL.Query().Get("page")
+	if p == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(p)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page %q", p)
+	}
+
+	return page, nil
+}
+
+// returns the pagination for a page of a listing, fetched is the number of
+// rows fetched, which should be one more than perPage if there's a next page
+func newPagination(page, fetched, perPage int) pagination {
+	p := pagination{Page: page}
+	if page > 1 {
+		p.PrevPage = page - 1
+	}
+	if fetched > perPage {
+		p.NextPage = page + 1
+	}
+
+	return p
+}
+
+// adds an entry to the audit log for an action taken by the current user
+func (app *application) recordAudit(r *http.Request, action, targetType string, targetID int, details string) error {
+	return app.audit.Insert(app.currentUser(r).ID, action, targetType, targetID, details)
+}
+
+// returns a random password nobody knows, for locking a user out of their
+// account until they reset it
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
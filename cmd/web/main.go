@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	// timezones for expiry dates, whatever the host has installed
+	_ "time/tzdata"
 
+	"snippetbox.derrc/internal/events"
+	"snippetbox.derrc/internal/mailer"
 	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/oidc"
+	"snippetbox.derrc/internal/pow"
+	"snippetbox.derrc/internal/ratelimit"
+	"snippetbox.derrc/internal/secrets"
+	"snippetbox.derrc/internal/spam"
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
@@ -22,16 +38,132 @@ import (
 type config struct {
 	addr string
 	dsn string
+	// externally visible URL, used for links in emails
+	baseURL string
+	smtp struct {
+		host string
+		port int
+		username string
+		password string
+		sender string
+	}
+	session struct {
+		lifetime time.Duration
+		rememberLifetime time.Duration
+		idleTimeout time.Duration
+		rotateEvery time.Duration
+		reauthAfter time.Duration
+	}
+	// single sign-on provider, SSO is off unless an issuer is given
+	oidc struct {
+		issuer string
+		clientID string
+		clientSecret string
+	}
+	// only allow new accounts through SSO
+	disableSignup bool
+	// credential scanning of new snippets
+	secretScan struct {
+		// off, warn or block
+		policy string
+		// JSON file of extra rules and allowlist entries
+		rulesFile string
+	}
+	// spam filtering of snippets from new accounts
+	spam struct {
+		// off, shadow or hold
+		mode string
+		newAccountAge time.Duration
+	}
+	// request rate limits, see rateLimitPolicies
+	rateLimit struct {
+		// memory, mysql or off
+		backend string
+		cleanupInterval time.Duration
+		general ratelimit.Limit
+		auth ratelimit.Limit
+		signup ratelimit.Limit
+		create ratelimit.Limit
+	}
+	// how long snippets can be kept
+	expiry struct {
+		max time.Duration
+		// user, moderator, admin or off
+		neverRole string
+	}
+	// limits on request and snippet sizes and on what each user can store
+	limits struct {
+		maxRequestBody int64
+		maxContent int
+		// zero means unlimited
+		quotaSnippets int
+		quotaBytes int64
+	}
+	// background deletion of expired and trashed snippets
+	purge struct {
+		// zero turns it off
+		interval time.Duration
+		batchSize int
+		trashRetention time.Duration
+	}
+	// proof-of-work challenges on signup and snippet creation
+	pow struct {
+		enabled bool
+		// hex encoded, random on every start if empty
+		key string
+		minDifficulty int
+		maxDifficulty int
+		// challenges issued per minute before difficulty goes up
+		baseline int
+	}
 }
 
 // application-wide dependencies
 type application struct {
 	logger *slog.Logger
 	snippets models.SnippetModelInterface
+	drafts models.DraftModelInterface
 	users models.UserModelInterface
+	tokens models.TokenModelInterface
+	twoFactor models.TwoFactorModelInterface
+	loginAttempts models.LoginAttemptModelInterface
+	userSessions models.UserSessionModelInterface
+	audit models.AuditModelInterface
+	reports models.ReportModelInterface
+	spam models.SpamModelInterface
+	spamFilter *spam.Filter
+	spamPolicy spamPolicy
+	// nil when rate limiting is off
+	rateLimiter ratelimit.Store
+	rateLimits rateLimitPolicies
+	expiryPolicy expiryPolicy
+	// request bodies larger than this are refused outright
+	maxRequestBody int64
+	maxContentBytes int
+	quota quotaPolicy
+	locks models.LockModelInterface
+	purgePolicy purgePolicy
+	// nil when proof-of-work challenges are off
+	pow *pow.Issuer
+	loginPolicy loginPolicy
+	sessionPolicy sessionPolicy
+	// nil when SSO isn't configured
+	oidc *oidc.Provider
+	signupDisabled bool
+	// nil when secret scanning is off
+	secretScanner *secrets.Scanner
+	// refuse snippets with likely secrets rather than asking for confirmation
+	blockSecrets bool
+	mailer mailer.Mailer
+	baseURL string
 	templateCache map[string]*template.Template
 	formDecoder *form.Decoder
 	sessionManager *scs.SessionManager
+	// newly published snippets, streamed on /events
+	events *events.Broker
+	eventsHeartbeat time.Duration
+	// tracks goroutines started with app.background()
+	wg sync.WaitGroup
 }
 
 func main() {
@@ -40,6 +172,49 @@ func main() {
 	// command-line flags
 	flag.StringVar(&cfg.addr, "addr", ":4000", "HTTP network address")
 	flag.StringVar(&cfg.dsn, "dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	flag.StringVar(&cfg.baseURL, "base-url", "https://localhost:4000", "Externally visible base URL")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Snippetbox <no-reply@snippetbox.derrc>", "SMTP sender")
+	flag.DurationVar(&cfg.session.lifetime, "session-lifetime", 12*time.Hour, "Lifetime of a normal login session")
+	flag.DurationVar(&cfg.session.rememberLifetime, "remember-lifetime", 30*24*time.Hour, "Lifetime of a \"remember me\" login session")
+	flag.DurationVar(&cfg.session.idleTimeout, "session-idle-timeout", 7*24*time.Hour, "Sessions expire after this long without a request")
+	flag.DurationVar(&cfg.session.rotateEvery, "session-rotate-every", 24*time.Hour, "How often a \"remember me\" session gets a new token")
+	flag.DurationVar(&cfg.session.reauthAfter, "reauth-after", time.Hour, "Sensitive actions need the password again after this long since login")
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL for SSO (SSO is disabled if empty)")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	flag.BoolVar(&cfg.disableSignup, "disable-signup", false, "Disable signing up with a password, new users have to use SSO")
+	flag.StringVar(&cfg.secretScan.policy, "secret-scan", "warn", "What to do with snippets containing likely secrets (off|warn|block)")
+	flag.StringVar(&cfg.secretScan.rulesFile, "secret-rules", "", "JSON file with extra secret scanning rules and allowlist entries")
+	flag.StringVar(&cfg.spam.mode, "spam-filter", spamModeHold, "What to do with suspected spam (off|shadow|hold), shadow only queues it for review")
+	flag.DurationVar(&cfg.spam.newAccountAge, "spam-new-account-age", 7*24*time.Hour, "Snippets from accounts younger than this go through the spam filter")
+	flag.StringVar(&cfg.rateLimit.backend, "ratelimit", "memory", "Where rate limits are kept (memory|mysql|off), use mysql to share them between instances")
+	flag.DurationVar(&cfg.rateLimit.cleanupInterval, "ratelimit-cleanup-interval", 5*time.Minute, "How often rate limits that have refilled and expired challenges are forgotten")
+	cfg.rateLimit.general = defaultRateLimitPolicies.general.limit
+	cfg.rateLimit.auth = defaultRateLimitPolicies.auth.limit
+	cfg.rateLimit.signup = defaultRateLimitPolicies.signup.limit
+	cfg.rateLimit.create = defaultRateLimitPolicies.create.limit
+	flag.Var(&cfg.rateLimit.general, "ratelimit-general", "Requests allowed per user or IP to any page, as burst/period or off")
+	flag.Var(&cfg.rateLimit.auth, "ratelimit-auth", "Login, password reset and reauthentication attempts allowed per IP, as burst/period or off")
+	flag.Var(&cfg.rateLimit.signup, "ratelimit-signup", "Signups allowed per IP, as burst/period or off")
+	flag.Var(&cfg.rateLimit.create, "ratelimit-create", "Snippets each user can create, as burst/period or off")
+	flag.DurationVar(&cfg.expiry.max, "max-expiry", 5*365*24*time.Hour, "Furthest in the future a snippet's expiry can be set")
+	flag.StringVar(&cfg.expiry.neverRole, "never-expire-role", models.RoleUser, "Lowest role allowed snippets that never expire (user|moderator|admin|off)")
+	flag.Int64Var(&cfg.limits.maxRequestBody, "max-request-body", 256*1024, "Largest request body accepted, in bytes")
+	flag.IntVar(&cfg.limits.maxContent, "max-content", 65535, "Largest snippet content accepted, in bytes (at most 65535, the size of the column)")
+	flag.IntVar(&cfg.limits.quotaSnippets, "quota-snippets", 1000, "Unexpired snippets each user can have (0 for no limit)")
+	flag.Int64Var(&cfg.limits.quotaBytes, "quota-bytes", 10*1024*1024, "Total size of the unexpired snippets each user can have, in bytes (0 for no limit)")
+	flag.DurationVar(&cfg.purge.interval, "purge-interval", 10*time.Minute, "How often expired snippets are deleted (0 to never delete them)")
+	flag.IntVar(&cfg.purge.batchSize, "purge-batch-size", 500, "Expired snippets deleted per transaction")
+	flag.DurationVar(&cfg.purge.trashRetention, "trash-retention", 30*24*time.Hour, "How long deleted snippets stay in the trash before they're purged")
+	flag.BoolVar(&cfg.pow.enabled, "pow", true, "Require a proof-of-work challenge, solved by the browser, to sign up or create a snippet")
+	flag.StringVar(&cfg.pow.key, "pow-key", "", "Hex encoded key for signing challenges, must be shared between instances (random if empty)")
+	flag.IntVar(&cfg.pow.minDifficulty, "pow-difficulty", 16, "Leading zero bits a solution needs under normal traffic")
+	flag.IntVar(&cfg.pow.maxDifficulty, "pow-max-difficulty", 22, "Most leading zero bits a solution needs however busy it gets")
+	flag.IntVar(&cfg.pow.baseline, "pow-baseline", 30, "Challenges issued per minute that count as normal traffic, each doubling adds a bit")
 	flag.Parse();
 
 	// initialize structured logger
@@ -66,19 +241,176 @@ func main() {
 	// initialize a new session manager
 	sessionManager := scs.New()
 	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = cfg.session.lifetime
+	sessionManager.IdleTimeout = cfg.session.idleTimeout
 	sessionManager.Cookie.Secure = true
+	// cookies only outlive the browser for "remember me" logins
+	sessionManager.Cookie.Persist = false
+
+	// initialize the SSO provider, its endpoints are discovered on first use
+	var oidcProvider *oidc.Provider
+	if cfg.oidc.issuer != "" {
+		oidcProvider = &oidc.Provider{
+			Issuer: cfg.oidc.issuer,
+			ClientID: cfg.oidc.clientID,
+			ClientSecret: cfg.oidc.clientSecret,
+			RedirectURL: cfg.baseURL + "/user/login/sso/callback",
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+
+	// initialize the secret scanner
+	secretScanner, err := newSecretScanner(cfg.secretScan.policy, cfg.secretScan.rulesFile)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	switch cfg.spam.mode {
+	case spamModeOff, spamModeShadow, spamModeHold:
+	default:
+		logger.Error(fmt.Sprintf("invalid -spam-filter mode %q", cfg.spam.mode))
+		os.Exit(1)
+	}
+
+	// initialize the rate limit store
+	var rateLimiter ratelimit.Store
+	switch cfg.rateLimit.backend {
+	case "memory":
+		rateLimiter = ratelimit.NewMemoryStore()
+	case "mysql":
+		rateLimiter = &models.RateLimitModel{DB: db}
+	case "off":
+	default:
+		logger.Error(fmt.Sprintf("invalid -ratelimit backend %q", cfg.rateLimit.backend))
+		os.Exit(1)
+	}
+
+	rateLimits := defaultRateLimitPolicies
+	rateLimits.general.limit = cfg.rateLimit.general
+	rateLimits.auth.limit = cfg.rateLimit.auth
+	rateLimits.signup.limit = cfg.rateLimit.signup
+	rateLimits.create.limit = cfg.rateLimit.create
+
+	neverRole := cfg.expiry.neverRole
+	switch neverRole {
+	case models.RoleUser, models.RoleModerator, models.RoleAdmin:
+	case "off":
+		neverRole = ""
+	default:
+		logger.Error(fmt.Sprintf("invalid -never-expire-role %q", cfg.expiry.neverRole))
+		os.Exit(1)
+	}
+
+	if cfg.limits.maxContent < 1 || cfg.limits.maxContent > 65535 {
+		logger.Error(fmt.Sprintf("invalid -max-content %d, want 1 to 65535", cfg.limits.maxContent))
+		os.Exit(1)
+	}
+
+	// initialize the proof-of-work issuer, used challenges are kept in MySQL
+	// so they can't be replayed against another instance
+	var powIssuer *pow.Issuer
+	if cfg.pow.enabled {
+		powIssuer, err = newPowIssuer(cfg.pow.key, cfg.pow.minDifficulty, cfg.pow.maxDifficulty, cfg.pow.baseline, &models.ChallengeModel{DB: db})
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// the spam classifier learns from moderators' decisions, kept in MySQL
+	spamModel := &models.SpamModel{DB: db}
 
 	// initialize instance of application with our dependencies
 	app := &application{
 		logger: logger,
 		snippets: &models.SnippetModel{DB: db},
+		drafts: &models.DraftModel{DB: db},
 		users: &models.UserModel{DB: db},
+		tokens: &models.TokenModel{DB: db},
+		twoFactor: &models.TwoFactorModel{DB: db},
+		loginAttempts: &models.LoginAttemptModel{DB: db},
+		userSessions: &models.UserSessionModel{DB: db},
+		audit: &models.AuditModel{DB: db},
+		reports: &models.ReportModel{DB: db},
+		spam: spamModel,
+		spamFilter: spam.NewFilter(spamModel),
+		spamPolicy: spamPolicy{
+			mode: cfg.spam.mode,
+			newAccountAge: cfg.spam.newAccountAge,
+		},
+		rateLimiter: rateLimiter,
+		rateLimits: rateLimits,
+		expiryPolicy: expiryPolicy{
+			max: cfg.expiry.max,
+			neverRole: neverRole,
+		},
+		maxRequestBody: cfg.limits.maxRequestBody,
+		maxContentBytes: cfg.limits.maxContent,
+		quota: quotaPolicy{
+			maxSnippets: cfg.limits.quotaSnippets,
+			maxBytes: cfg.limits.quotaBytes,
+		},
+		locks: &models.LockModel{DB: db},
+		purgePolicy: purgePolicy{
+			interval: cfg.purge.interval,
+			batchSize: cfg.purge.batchSize,
+			batchDelay: 100 * time.Millisecond,
+			trashRetention: cfg.purge.trashRetention,
+		},
+		pow: powIssuer,
+		loginPolicy: defaultLoginPolicy,
+		sessionPolicy: sessionPolicy{
+			lifetime: cfg.session.lifetime,
+			rememberLifetime: cfg.session.rememberLifetime,
+			rotateEvery: cfg.session.rotateEvery,
+			reauthAfter: cfg.session.reauthAfter,
+		},
+		oidc: oidcProvider,
+		signupDisabled: cfg.disableSignup,
+		secretScanner: secretScanner,
+		blockSecrets: cfg.secretScan.policy == "block",
+		mailer: &mailer.SMTP{
+			Host: cfg.smtp.host,
+			Port: cfg.smtp.port,
+			Username: cfg.smtp.username,
+			Password: cfg.smtp.password,
+			Sender: cfg.smtp.sender,
+		},
+		baseURL: cfg.baseURL,
 		templateCache: templateCache,
 		formDecoder: formDecoder,
 		sessionManager: sessionManager,
+		events: events.NewBroker(eventsBuffer, eventsHistory),
+		eventsHeartbeat: 30 * time.Second,
+	}
+
+	// cancelled on Ctrl-C or SIGTERM, which stops the background workers and
+	// shuts the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if app.rateLimiter != nil || app.pow != nil {
+		app.background(func() {
+			app.runCleanup(ctx, cfg.rateLimit.cleanupInterval)
+		})
 	}
 
+	if cfg.purge.interval > 0 {
+		if cfg.purge.batchSize < 1 {
+			logger.Error(fmt.Sprintf("invalid -purge-batch-size %d", cfg.purge.batchSize))
+			os.Exit(1)
+		}
+
+		app.background(func() {
+			app.runPurger(ctx)
+		})
+	}
+
+	app.background(func() {
+		app.runScheduledPublisher(ctx, scheduledPublishInterval)
+	})
+
 	// TLS settings for https server
 	tlsConfig := &tls.Config{
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
@@ -95,11 +427,40 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// event streams never finish by themselves, end them so shutting down
+	// doesn't wait for them
+	srv.RegisterOnShutdown(app.events.Close)
+
+	// let requests in flight finish once we're told to stop
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	logger.Info("starting server", "addr", cfg.addr)
 
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	logger.Error(err.Error())
-	os.Exit(1)
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// wait for emails being sent and the background workers
+	app.wg.Wait()
+
+	logger.Info("stopped server")
 }
 
 // returns an sql.DB connection pool
@@ -116,4 +477,61 @@ func openDB(dsn string) (*sql.DB, error) {
 	}
 
 	return db, nil
-}
\ No newline at end of file
+}
+
+// returns the scanner for the given policy, nil if scanning is off
+func newSecretScanner(policy, rulesFile string) (*secrets.Scanner, error) {
+	switch policy {
+	case "off":
+		return nil, nil
+	case "warn", "block":
+	default:
+		return nil, fmt.Errorf("invalid -secret-scan policy %q", policy)
+	}
+
+	if rulesFile == "" {
+		return secrets.New(), nil
+	}
+
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return secrets.Load(f)
+}
+
+// returns the proof-of-work issuer, challenges signed with a random key
+// stop working when the program restarts
+func newPowIssuer(key string, minDifficulty, maxDifficulty, baseline int, used pow.Store) (*pow.Issuer, error) {
+	if minDifficulty < 0 || maxDifficulty < minDifficulty || maxDifficulty > 32 {
+		return nil, fmt.Errorf("invalid -pow-difficulty %d and -pow-max-difficulty %d", minDifficulty, maxDifficulty)
+	}
+
+	var (
+		k []byte
+		err error
+	)
+	if key == "" {
+		k, err = pow.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		k, err = hex.DecodeString(key)
+		if err != nil || len(k) < 32 {
+			return nil, errors.New("invalid -pow-key, want at least 32 hex encoded bytes")
+		}
+	}
+
+	return &pow.Issuer{
+		Key: k,
+		TTL: time.Hour,
+		MinDifficulty: minDifficulty,
+		MaxDifficulty: maxDifficulty,
+		Baseline: baseline,
+		Window: time.Minute,
+		Used: used,
+	}, nil
+}
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"snippetbox.derrc/internal/models"
 
 	"github.com/justinas/nosurf"
 )
@@ -40,6 +49,41 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
+// limits how often the same client (see rateLimitPolicy.keyBy) can use the
+// wrapped routes. RateLimit-* headers tell it how much of its allowance is
+// left, once it's all used requests get a 429 with Retry-After.
+func (app *application) rateLimit(p rateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.rateLimiter == nil || p.limit.Unlimited() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := app.rateLimiter.Take(r.Context(), app.rateLimitKey(r, p), p.limit, time.Now())
+			if err != nil {
+				// let the request through, the site shouldn't go down with the store
+				app.logger.Error("rate limiter failed", "policy", p.name, "error", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", p.limit.Policy())
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // gracefully shuts down in the event of a panic by setting the 'Connection' header
 // and writing an error response before closing the underyling HTTP connection for the
 // affected goroutine
@@ -77,6 +121,55 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// redirects users who haven't verified their email address to their account
+// page, must come after requireAuthentication in the middleware chain
+func (app *application) requireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.currentUser(r).EmailVerified {
+			app.sessionManager.Put(r.Context(), "flash", "Please verify your email address before creating snippets.")
+			http.Redirect(w, r, "/account", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// only lets through users with the given role (or a higher one), must come
+// after requireAuthentication in the middleware chain
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.currentUser(r).HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sends users who logged in too long ago to re-enter their password before
+// sensitive actions, must come after requireAuthentication in the middleware chain
+func (app *application) requireRecentLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.recentlyAuthenticated(r.Context()) {
+			// a POST can't be replayed after the redirect, so come back to the
+			// page the form was on instead
+			target := r.URL.RequestURI()
+			if r.Method != http.MethodGet {
+				target = r.URL.Path
+			}
+
+			http.Redirect(w, r, "/user/reauth?next="+url.QueryEscape(target), http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // checks if session data contains 'authenticatedUserID' and if so
 // adds (isAuthenticatedContextKey, true) to the request context
 // for all future middlewares/handlers
@@ -87,17 +180,53 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		
-		// make sure that user id exists
-		exists, err := app.users.Exists(id)
+
+		// make sure the login session hasn't been revoked (i.e. from another
+		// browser or by a password change), if it has then log this one out
+		valid, err := app.userSessions.Touch(app.sessionManager.GetString(r.Context(), "loginSessionID"), id)
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
 
-		if exists {
+		if !valid {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			app.sessionManager.Remove(r.Context(), "loginSessionID")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// long-lived "remember me" sessions get a new token every so often,
+		// so a stolen cookie doesn't stay useful for the whole lifetime
+		rotatedAt := time.Unix(app.sessionManager.GetInt64(r.Context(), "tokenRotatedAt"), 0)
+		if app.sessionManager.GetBool(r.Context(), "rememberMe") && time.Since(rotatedAt) > app.sessionPolicy.rotateEvery {
+			err = app.renewSessionToken(r.Context())
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		// make sure that user id exists, and load the user for handlers and
+		// middleware further down the chain
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// disabled users are logged out
+		if err == nil && user.Disabled {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			app.sessionManager.Remove(r.Context(), "loginSessionID")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err == nil {
 			// reassigns request context, adding (isAuthenticatedContextKey, true)
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, currentUserContextKey, user)
 			r = r.WithContext(ctx)
 		}
 
@@ -117,4 +246,41 @@ func noSurf(next http.Handler) http.Handler {
 	})
 
 	return csrfHandler
-}
\ No newline at end of file
+}
+
+// refuses request bodies over app.maxRequestBody, by Content-Length when it's
+// given and otherwise by reading the body up front. Past this point a body
+// that's too long would only show up as an error deep inside nosurf or
+// r.ParseForm, and end up as a 400.
+func (app *application) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > app.maxRequestBody {
+			// don't bother reading the rest
+			w.Header().Set("Connection", "close")
+			app.clientError(w, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, app.maxRequestBody)
+
+		// chunked, the body is at most app.maxRequestBody so it's fine to
+		// hold in memory
+		if r.ContentLength < 0 {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					app.clientError(w, http.StatusRequestEntityTooLarge)
+				} else {
+					app.clientError(w, http.StatusBadRequest)
+				}
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
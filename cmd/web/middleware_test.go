@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/ratelimit"
 )
 
 func TestCommonHeaders(t *testing.T) {
@@ -56,4 +60,234 @@ func TestCommonHeaders(t *testing.T) {
 	body = bytes.TrimSpace(body)
 
 	assert.Equal(t, string(body), "OK")
-}
\ No newline at end of file
+}
+
+func TestRequireRole(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name string
+		user models.User
+		wantCode int
+	}{
+		{
+			name: "Not logged in",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "User",
+			user: models.User{ID: 1, Role: models.RoleUser},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "Moderator",
+			user: models.User{ID: 6, Role: models.RoleModerator},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "Admin",
+			user: models.User{ID: 5, Role: models.RoleAdmin},
+			wantCode: http.StatusOK,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.user.ID != 0 {
+				ctx := context.WithValue(r.Context(), currentUserContextKey, tt.user)
+				r = r.WithContext(ctx)
+			}
+
+			app.requireRole(models.RoleModerator)(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimiter = ratelimit.NewMemoryStore()
+
+	policy := rateLimitPolicy{
+		name: "test",
+		limit: ratelimit.Limit{Burst: 2, Period: time.Minute},
+		keyBy: rateLimitByUser,
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := app.rateLimit(policy)(next)
+
+	request := func(remoteAddr string, user models.User) *http.Response {
+		rr := httptest.NewRecorder()
+
+		r, err := http.NewRequest(http.MethodPost, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = remoteAddr
+
+		if user.ID != 0 {
+			ctx := context.WithValue(r.Context(), currentUserContextKey, user)
+			r = r.WithContext(ctx)
+		}
+
+		handler.ServeHTTP(rr, r)
+		return rr.Result()
+	}
+
+	rs := request("192.0.2.1:1234", models.User{})
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("RateLimit-Policy"), "2;w=60")
+	assert.Equal(t, rs.Header.Get("RateLimit-Limit"), "2")
+	assert.Equal(t, rs.Header.Get("RateLimit-Remaining"), "1")
+	assert.Equal(t, rs.Header.Get("RateLimit-Reset"), "30")
+
+	// a different port is the same client
+	rs = request("192.0.2.1:5678", models.User{})
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("RateLimit-Remaining"), "0")
+
+	rs = request("192.0.2.1:1234", models.User{})
+	assert.Equal(t, rs.StatusCode, http.StatusTooManyRequests)
+	assert.Equal(t, rs.Header.Get("Retry-After"), "30")
+	assert.Equal(t, rs.Header.Get("RateLimit-Reset"), "60")
+
+	// other IPs and logged in users have their own allowance, wherever
+	// they're connecting from
+	rs = request("192.0.2.2:1234", models.User{})
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+
+	alice := models.User{ID: 1}
+	for _, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rs = request("192.0.2.1:1234", alice)
+		assert.Equal(t, rs.StatusCode, want)
+	}
+
+	// off
+	app.rateLimiter = nil
+	rs = request("192.0.2.1:1234", alice)
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("RateLimit-Limit"), "")
+}
+
+func TestRateLimitKey(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name string
+		keyBy string
+		user models.User
+		authorization string
+		want string
+	}{
+		{
+			name: "IP",
+			keyBy: rateLimitByIP,
+			user: models.User{ID: 1},
+			want: "p:ip:192.0.2.1",
+		},
+		{
+			name: "User",
+			keyBy: rateLimitByUser,
+			user: models.User{ID: 1},
+			want: "p:user:1",
+		},
+		{
+			name: "Anonymous user",
+			keyBy: rateLimitByUser,
+			want: "p:ip:192.0.2.1",
+		},
+		{
+			name: "Token",
+			keyBy: rateLimitByToken,
+			user: models.User{ID: 1},
+			authorization: "Bearer secret",
+			want: "p:token:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+		},
+		{
+			name: "No token",
+			keyBy: rateLimitByToken,
+			user: models.User{ID: 1},
+			want: "p:user:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("Authorization", tt.authorization)
+
+			if tt.user.ID != 0 {
+				ctx := context.WithValue(r.Context(), currentUserContextKey, tt.user)
+				r = r.WithContext(ctx)
+			}
+
+			got := app.rateLimitKey(r, rateLimitPolicy{name: "p", keyBy: tt.keyBy})
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	app := newTestApplication(t)
+	app.maxRequestBody = 10
+
+	// reads the whole body, like parsing a form does, and turns any error
+	// into a 400 the way handlers do
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name string
+		body string
+		// unknown length, as for a chunked body
+		hideLength bool
+		wantCode int
+	}{
+		{name: "Within limit", body: "0123456789", wantCode: http.StatusOK},
+		{name: "Too long", body: "0123456789a", wantCode: http.StatusRequestEntityTooLarge},
+		{name: "Too long, unknown length", body: "0123456789a", hideLength: true, wantCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			r, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.hideLength {
+				r.ContentLength = -1
+			}
+
+			app.limitRequestBody(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"snippetbox.derrc/internal/models"
 	"snippetbox.derrc/ui"
 
 	"github.com/justinas/alice"
@@ -18,24 +19,118 @@ func (app *application) routes() http.Handler {
 
 	mux.HandleFunc("GET /ping", ping)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// public routes for feed readers and event streams, they don't need a
+	// session
+	public := alice.New(app.rateLimit(app.rateLimits.general))
+
+	mux.Handle("GET /feed.atom", public.Then(app.latestFeed(feedFormatAtom)))
+	mux.Handle("GET /feed.rss", public.Then(app.latestFeed(feedFormatRSS)))
+	mux.Handle("GET /user/{ref}/feed.atom", public.Then(app.userFeed(feedFormatAtom)))
+	mux.Handle("GET /user/{ref}/feed.rss", public.Then(app.userFeed(feedFormatRSS)))
+	mux.Handle("GET /events", public.ThenFunc(app.eventStream))
+
+	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate, app.rateLimit(app.rateLimits.general))
+
+	// dynamic routes that can be used to guess passwords, or flood inboxes
+	auth := dynamic.Append(app.rateLimit(app.rateLimits.auth))
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
-	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
+	mux.Handle("POST /user/signup", dynamic.Append(app.rateLimit(app.rateLimits.signup)).ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
-	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("POST /user/login", auth.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	mux.Handle("POST /user/login/2fa", auth.ThenFunc(app.userLoginTwoFactorPost))
+	mux.Handle("GET /user/login/link", dynamic.ThenFunc(app.userLoginLink))
+	mux.Handle("POST /user/login/link", auth.ThenFunc(app.userLoginLinkPost))
+	mux.Handle("GET /user/login/link/confirm", dynamic.ThenFunc(app.userLoginLinkConfirm))
+	mux.Handle("POST /user/login/link/confirm", auth.ThenFunc(app.userLoginLinkConfirmPost))
+	mux.Handle("GET /user/login/sso", dynamic.ThenFunc(app.userLoginSSO))
+	mux.Handle("GET /user/login/sso/callback", dynamic.ThenFunc(app.userLoginSSOCallback))
+	mux.Handle("GET /user/password/forgot", dynamic.ThenFunc(app.userPasswordForgot))
+	mux.Handle("POST /user/password/forgot", auth.ThenFunc(app.userPasswordForgotPost))
+	mux.Handle("GET /user/password/reset", dynamic.ThenFunc(app.userPasswordReset))
+	mux.Handle("POST /user/password/reset", auth.ThenFunc(app.userPasswordResetPost))
+	mux.Handle("GET /user/verify", dynamic.ThenFunc(app.userVerify))
+	mux.Handle("POST /user/verify", dynamic.ThenFunc(app.userVerifyPost))
+	mux.Handle("GET /user/unlock", dynamic.ThenFunc(app.userUnlock))
+	mux.Handle("POST /user/unlock", auth.ThenFunc(app.userUnlockPost))
+	mux.Handle("GET /user/{ref}", dynamic.ThenFunc(app.userProfile))
 
 	// protected routes
 	protected := dynamic.Append(app.requireAuthentication)
 
-	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
-	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /user/reauth", protected.ThenFunc(app.userReauth))
+	mux.Handle("POST /user/reauth", protected.Append(app.rateLimit(app.rateLimits.auth)).ThenFunc(app.userReauthPost))
+	mux.Handle("GET /account", protected.ThenFunc(app.account))
+	mux.Handle("GET /account/name", protected.ThenFunc(app.accountName))
+	mux.Handle("POST /account/name", protected.ThenFunc(app.accountNamePost))
+	mux.Handle("POST /account/verify/resend", protected.ThenFunc(app.accountVerifyResendPost))
+	mux.Handle("GET /account/sessions", protected.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/{id}/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	mux.Handle("GET /snippet/expiry/{id}", protected.ThenFunc(app.snippetExpiry))
+	mux.Handle("POST /snippet/expiry/{id}", protected.ThenFunc(app.snippetExpiryPost))
+	mux.Handle("GET /snippet/schedule/{id}", protected.ThenFunc(app.snippetSchedule))
+	mux.Handle("POST /snippet/schedule/{id}", protected.ThenFunc(app.snippetSchedulePost))
+	mux.Handle("GET /user/scheduled", protected.ThenFunc(app.userScheduled))
+	mux.Handle("POST /snippet/delete/{id}", protected.ThenFunc(app.snippetDeletePost))
+	mux.Handle("GET /user/trash", protected.ThenFunc(app.userTrash))
+	mux.Handle("POST /user/trash/{id}/restore", protected.ThenFunc(app.userTrashRestorePost))
+	mux.Handle("POST /user/trash/{id}/delete", protected.ThenFunc(app.userTrashDeletePost))
+	mux.Handle("GET /snippet/report/{id}", protected.ThenFunc(app.snippetReport))
+	mux.Handle("POST /snippet/report/{id}", protected.ThenFunc(app.snippetReportPost))
+
+	// protected routes that need the password to have been entered recently
+	sensitive := protected.Append(app.requireRecentLogin)
+
+	mux.Handle("GET /account/email", sensitive.ThenFunc(app.accountEmail))
+	mux.Handle("POST /account/email", sensitive.ThenFunc(app.accountEmailPost))
+	mux.Handle("GET /account/password", sensitive.ThenFunc(app.accountPassword))
+	mux.Handle("POST /account/password", sensitive.ThenFunc(app.accountPasswordPost))
+	mux.Handle("GET /account/2fa", sensitive.ThenFunc(app.accountTwoFactor))
+	mux.Handle("GET /account/2fa/setup", sensitive.ThenFunc(app.accountTwoFactorSetup))
+	mux.Handle("POST /account/2fa/setup", sensitive.ThenFunc(app.accountTwoFactorSetupPost))
+	mux.Handle("POST /account/2fa/disable", sensitive.ThenFunc(app.accountTwoFactorDisablePost))
+
+	// routes for moderators (and admins)
+	moderator := protected.Append(app.requireRole(models.RoleModerator))
+
+	mux.Handle("GET /moderation", moderator.ThenFunc(app.moderation))
+	mux.Handle("POST /moderation/reports/{id}/dismiss", moderator.ThenFunc(app.moderationDismissPost))
+	mux.Handle("POST /moderation/reports/{id}/hide", moderator.ThenFunc(app.moderationHidePost))
+	mux.Handle("POST /moderation/reports/{id}/ban", moderator.ThenFunc(app.moderationBanPost))
+	mux.Handle("GET /moderation/spam", moderator.ThenFunc(app.moderationSpam))
+	mux.Handle("POST /moderation/spam/{id}/spam", moderator.Then(app.moderationSpamDecision(models.SpamDecisionSpam)))
+	mux.Handle("POST /moderation/spam/{id}/ham", moderator.Then(app.moderationSpamDecision(models.SpamDecisionHam)))
+
+	// routes only admins can use
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+
+	mux.Handle("GET /admin", admin.ThenFunc(app.admin))
+	mux.Handle("POST /admin/users/role", admin.ThenFunc(app.adminRolePost))
+	mux.Handle("GET /admin/users", admin.ThenFunc(app.adminUsers))
+	mux.Handle("POST /admin/users/{id}/disable", admin.ThenFunc(app.adminUserDisablePost))
+	mux.Handle("POST /admin/users/{id}/enable", admin.ThenFunc(app.adminUserEnablePost))
+	mux.Handle("POST /admin/users/{id}/reset-password", admin.ThenFunc(app.adminUserResetPasswordPost))
+	mux.Handle("GET /admin/snippets", admin.ThenFunc(app.adminSnippets))
+	mux.Handle("POST /admin/snippets/{id}/hide", admin.Then(app.adminSnippetAction(models.AuditSnippetHide)))
+	mux.Handle("POST /admin/snippets/{id}/unhide", admin.Then(app.adminSnippetAction(models.AuditSnippetUnhide)))
+	mux.Handle("POST /admin/snippets/{id}/delete", admin.Then(app.adminSnippetAction(models.AuditSnippetDelete)))
+
+	// protected routes that also need a verified email address
+	verified := protected.Append(app.requireVerifiedEmail)
+
+	mux.Handle("GET /snippet/create", verified.ThenFunc(app.snippetCreate))
+	mux.Handle("POST /snippet/create", verified.Append(app.rateLimit(app.rateLimits.create)).ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /user/drafts", verified.ThenFunc(app.userDrafts))
+	mux.Handle("POST /user/drafts", verified.ThenFunc(app.userDraftSavePost))
+	mux.Handle("POST /user/drafts/{id}/delete", verified.ThenFunc(app.userDraftDeletePost))
 
 	// middleware chain with our 'standard' middleware used for every request
-	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
+	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders, app.limitRequestBody)
 
 	return standard.Then(mux)
 }
\ No newline at end of file
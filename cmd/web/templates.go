@@ -1,12 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"path/filepath"
 	"time"
 
 	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/pow"
+	"snippetbox.derrc/internal/secrets"
 	"snippetbox.derrc/ui"
 )
 
@@ -17,7 +20,67 @@ type templateData struct {
 	Form any
 	Flash string
 	IsAuthenticated bool
+	// the logged in user, use .CurrentUser.Role or .CurrentUser.HasRole for
+	// role checks
+	CurrentUser models.User
 	CSRFToken string
+	SSOEnabled bool
+	SignupEnabled bool
+	// the current user can choose for snippets to never expire
+	AllowNeverExpire bool
+	ProfileUser models.User
+	Pagination pagination
+	TwoFactor twoFactorData
+	Sessions []models.UserSession
+	CurrentSessionID string
+	Users []models.User
+	Search string
+	DailyCounts []models.DailyCount
+	AuditEntries []models.AuditEntry
+	LoginEvents []models.LoginEvent
+	Reports []models.Report
+	SecretScan secretScanData
+	SpamReviews []models.SpamReview
+	Quota quotaData
+	// how long snippets stay in the trash before they're purged
+	TrashRetentionDays int
+	Drafts []models.Draft
+	DraftCount int
+	// proof-of-work challenge for the form on the page, see challengeScopes
+	Challenge pow.Challenge
+}
+
+// page numbers for paginated listings, PrevPage/NextPage are 0 when there is no such page
+type pagination struct {
+	Page int
+	PrevPage int
+	NextPage int
+}
+
+// two-factor authentication state for the account pages
+type twoFactorData struct {
+	Enabled bool
+	Secret string
+	// trusted otpauth:// link, html/template would otherwise filter the scheme
+	URI template.URL
+	RecoveryCodes []string
+	RecoveryCodesRemaining int
+}
+
+// likely credentials found in a snippet being created
+type secretScanData struct {
+	Findings []secrets.Finding
+	// value of the checkbox that confirms publishing anyway
+	Fingerprint string
+	// the snippet can't be published until they're removed
+	Blocked bool
+}
+
+// a user's storage and their limits, zero meaning no limit
+type quotaData struct {
+	Usage models.SnippetUsage
+	MaxSnippets int
+	MaxBytes int64
 }
 
 // returns a formatted string representation of time.Time object
@@ -29,8 +92,25 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// returns a size in bytes for people, e.g. "1.5 MB"
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"humanBytes": humanBytes,
 }
 
 // store parsed templates in an in-memory cache
@@ -37,4 +37,24 @@ func TestHumanDate(t *testing.T) {
 			assert.Equal(t, hd, tt.want)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n int64
+		want string
+	}{
+		{n: 0, want: "0 bytes"},
+		{n: 1023, want: "1023 bytes"},
+		{n: 1024, want: "1.0 KB"},
+		{n: 1536, want: "1.5 KB"},
+		{n: 10 * 1024 * 1024, want: "10.0 MB"},
+		{n: 3 << 30, want: "3.0 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, humanBytes(tt.n), tt.want)
+		})
+	}
+}
@@ -10,10 +10,18 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"snippetbox.derrc/internal/events"
+	"snippetbox.derrc/internal/mailer"
+	"snippetbox.derrc/internal/models"
 	"snippetbox.derrc/internal/models/mocks"
+	"snippetbox.derrc/internal/pow"
+	"snippetbox.derrc/internal/secrets"
+	"snippetbox.derrc/internal/spam"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
@@ -30,6 +38,22 @@ func extractCSRFToken(t *testing.T, body string) string {
 	return html.UnescapeString(string(matches[1]))
 }
 
+var challengeRX = regexp.MustCompile(`<input type='hidden' name='pow_challenge' value='(.+)' data-difficulty='(\d+)'>`)
+
+func extractChallenge(t *testing.T, body string) pow.Challenge {
+	matches := challengeRX.FindStringSubmatch(body)
+	if len(matches) < 3 {
+		t.Fatal("no proof-of-work challenge found in body")
+	}
+
+	difficulty, err := strconv.Atoi(matches[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pow.Challenge{Token: html.UnescapeString(matches[1]), Difficulty: difficulty}
+}
+
 func newTestApplication(t *testing.T) *application {
 	templateCache, err := newTemplateCache()
 	if err != nil {
@@ -40,12 +64,58 @@ func newTestApplication(t *testing.T) *application {
 
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.IdleTimeout = 7 * 24 * time.Hour
 	sessionManager.Cookie.Secure = true
+	sessionManager.Cookie.Persist = false
+
+	spamModel := &mocks.SpamModel{}
 
 	return &application{
 		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
 		snippets: &mocks.SnippetModel{},
+		drafts: &mocks.DraftModel{},
+		events: events.NewBroker(eventsBuffer, eventsHistory),
+		eventsHeartbeat: 30 * time.Second,
 		users: &mocks.UserModel{},
+		tokens: &mocks.TokenModel{},
+		twoFactor: &mocks.TwoFactorModel{},
+		loginAttempts: &mocks.LoginAttemptModel{},
+		userSessions: &mocks.UserSessionModel{},
+		audit: &mocks.AuditModel{},
+		reports: &mocks.ReportModel{},
+		spam: spamModel,
+		spamFilter: spam.NewFilter(spamModel),
+		spamPolicy: spamPolicy{
+			mode: spamModeHold,
+			newAccountAge: 7 * 24 * time.Hour,
+		},
+		rateLimits: defaultRateLimitPolicies,
+		expiryPolicy: expiryPolicy{
+			max: 5 * 365 * 24 * time.Hour,
+			neverRole: models.RoleModerator,
+		},
+		locks: &mocks.LockModel{},
+		purgePolicy: purgePolicy{
+			interval: time.Minute,
+			batchSize: 100,
+			trashRetention: 30 * 24 * time.Hour,
+		},
+		maxRequestBody: 256 * 1024,
+		maxContentBytes: 65535,
+		quota: quotaPolicy{
+			maxSnippets: 1000,
+			maxBytes: 10 * 1024 * 1024,
+		},
+		loginPolicy: defaultLoginPolicy,
+		sessionPolicy: sessionPolicy{
+			lifetime: 12 * time.Hour,
+			rememberLifetime: 30 * 24 * time.Hour,
+			rotateEvery: 24 * time.Hour,
+			reauthAfter: time.Hour,
+		},
+		secretScanner: secrets.New(),
+		mailer: &mailer.Memory{},
+		baseURL: "https://localhost:4000",
 		templateCache: templateCache,
 		formDecoder: formDecorder,
 		sessionManager: sessionManager,
@@ -111,4 +181,50 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	body = bytes.TrimSpace(body)
 
 	return rs.StatusCode, rs.Header, string(body)
-}
\ No newline at end of file
+}
+
+// makes a POST request to url with body as JSON, sending the CSRF token in
+// a header the way scripts do
+func (ts *testServer) postJSON(t *testing.T, urlPath, csrfToken, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody = bytes.TrimSpace(respBody)
+
+	return rs.StatusCode, rs.Header, string(respBody)
+}
+
+// logs in as the mock user with the given email and returns a CSRF token
+// for further requests
+func (ts *testServer) login(t *testing.T, email string) string {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+
+	return csrfToken
+}
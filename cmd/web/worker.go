@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// settings for the background purge of expired and trashed snippets
+type purgePolicy struct {
+	interval time.Duration
+	batchSize int
+	// pause between batches, so other queries get a turn at the table
+	batchDelay time.Duration
+	// how long snippets stay in the trash
+	trashRetention time.Duration
+}
+
+// what one purge did, logged when it's finished
+type purgeStats struct {
+	// expired snippets deleted
+	deleted int
+	// snippets deleted from the trash
+	trashed int
+	batches int
+}
+
+// name of the advisory lock held while purging, so only one instance of the
+// app does it at a time
+const purgeLockName = "snippetbox.purge"
+
+// purges expired snippets and old trash every app.purgePolicy.interval
+// until ctx is cancelled
+func (app *application) runPurger(ctx context.Context) {
+	ticker := time.NewTicker(app.purgePolicy.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purge(ctx)
+		}
+	}
+}
+
+// purges expired snippets and old trash unless another instance already
+// is, and logs what it did
+func (app *application) purge(ctx context.Context) {
+	start := time.Now()
+
+	var stats purgeStats
+
+	locked, err := app.locks.TryLock(ctx, purgeLockName, func(ctx context.Context) error {
+		var err error
+		stats, err = app.purgeExpired(ctx)
+		return err
+	})
+
+	switch {
+	case !locked && err == nil:
+		app.logger.Debug("purge skipped, another instance is purging")
+	case errors.Is(err, context.Canceled):
+		app.logger.Info("purge interrupted", "deleted", stats.deleted, "trashed", stats.trashed, "batches", stats.batches, "duration", time.Since(start))
+	case err != nil:
+		app.logger.Error("purge failed", "error", err.Error(), "deleted", stats.deleted, "trashed", stats.trashed, "batches", stats.batches)
+	default:
+		app.logger.Info("purged snippets", "deleted", stats.deleted, "trashed", stats.trashed, "batches", stats.batches, "duration", time.Since(start))
+	}
+}
+
+// deletes expired snippets, then snippets that have been in the trash for
+// longer than the retention window, a batch at a time until there are none
+// left or ctx is cancelled
+func (app *application) purgeExpired(ctx context.Context) (purgeStats, error) {
+	var stats purgeStats
+
+	trashBefore := time.Now().Add(-app.purgePolicy.trashRetention)
+
+	steps := []struct {
+		deleted *int
+		deleteBatch func(ctx context.Context, limit int) (int, error)
+	}{
+		{&stats.deleted, app.snippets.DeleteExpired},
+		{&stats.trashed, func(ctx context.Context, limit int) (int, error) {
+			return app.snippets.PurgeTrash(ctx, trashBefore, limit)
+		}},
+	}
+
+	for _, step := range steps {
+		for {
+			n, err := step.deleteBatch(ctx, app.purgePolicy.batchSize)
+			if err != nil {
+				return stats, err
+			}
+
+			*step.deleted += n
+			stats.batches++
+
+			if n < app.purgePolicy.batchSize {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return stats, ctx.Err()
+			case <-time.After(app.purgePolicy.batchDelay):
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// periodically forgets rate limit buckets that have refilled and
+// proof-of-work challenges that have expired, until ctx is cancelled
+func (app *application) runCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if app.rateLimiter != nil {
+			err := app.rateLimiter.Cleanup(ctx, time.Now())
+			if err != nil {
+				app.logger.Error("rate limit cleanup failed", "error", err.Error())
+			}
+		}
+
+		if app.pow != nil {
+			err := app.pow.Used.Cleanup(ctx, time.Now())
+			if err != nil {
+				app.logger.Error("challenge cleanup failed", "error", err.Error())
+			}
+		}
+	}
+}
+
+// how often scheduled snippets that have been published are looked for, to
+// announce them on /events
+const scheduledPublishInterval = 15 * time.Second
+
+// announces scheduled snippets on /events as they're published, looking
+// for them every interval until ctx is cancelled. Snippets published early
+// with "Publish now" are picked up the same way.
+func (app *application) runScheduledPublisher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// publication times are stored in whole seconds
+	last := time.Now().Truncate(time.Second)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			last = app.publishScheduled(last, time.Now().Truncate(time.Second))
+		}
+	}
+}
+
+// announces the scheduled snippets published after after and no later than
+// until, returns where the next look should start from
+func (app *application) publishScheduled(after, until time.Time) time.Time {
+	snippets, err := app.snippets.PublishedBetween(after, until)
+	if err != nil {
+		app.logger.Error("looking for published snippets failed", "error", err.Error())
+		// try the same stretch again next time
+		return after
+	}
+
+	for _, s := range snippets {
+		err = app.publishSnippet(s)
+		if err != nil {
+			app.logger.Error("announcing snippet failed", "id", s.ID, "error", err.Error())
+		}
+	}
+
+	return until
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/models/mocks"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		expired int
+		trashed int
+		wantBatches int
+	}{
+		{name: "None", wantBatches: 2},
+		{name: "Partial batch", expired: 250, wantBatches: 4},
+		// the last batch finds nothing
+		{name: "Full batches", expired: 200, wantBatches: 4},
+		{name: "Trash", expired: 50, trashed: 120, wantBatches: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			snippets := &mocks.SnippetModel{Expired: tt.expired, TrashExpired: tt.trashed}
+			app.snippets = snippets
+
+			stats, err := app.purgeExpired(context.Background())
+			assert.NilError(t, err)
+			assert.Equal(t, stats.deleted, tt.expired)
+			assert.Equal(t, stats.trashed, tt.trashed)
+			assert.Equal(t, stats.batches, tt.wantBatches)
+			assert.Equal(t, snippets.Expired, 0)
+			assert.Equal(t, snippets.TrashExpired, 0)
+		})
+	}
+}
+
+func TestPurgeExpiredCancelled(t *testing.T) {
+	app := newTestApplication(t)
+	app.purgePolicy.batchDelay = time.Hour
+	snippets := &mocks.SnippetModel{Expired: 250}
+	app.snippets = snippets
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// stops after the first batch rather than waiting for the next
+	stats, err := app.purgeExpired(ctx)
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, stats.deleted, 100)
+	assert.Equal(t, snippets.Expired, 150)
+}
+
+func TestPurgeLocked(t *testing.T) {
+	app := newTestApplication(t)
+	snippets := &mocks.SnippetModel{Expired: 10}
+	app.snippets = snippets
+
+	// another instance is purging
+	app.locks = &mocks.LockModel{Held: true}
+	app.purge(context.Background())
+	assert.Equal(t, snippets.Expired, 10)
+
+	app.locks = &mocks.LockModel{}
+	app.purge(context.Background())
+	assert.Equal(t, snippets.Expired, 0)
+}
+
+func TestRunPurger(t *testing.T) {
+	app := newTestApplication(t)
+	app.purgePolicy.interval = time.Millisecond
+	snippets := &mocks.SnippetModel{Expired: 10}
+	app.snippets = snippets
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		app.runPurger(ctx)
+		close(done)
+	}()
+
+	// long enough for a few ticks
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("purger didn't stop when its context was cancelled")
+	}
+
+	assert.Equal(t, snippets.Expired, 0)
+}
+
+func TestPublishScheduled(t *testing.T) {
+	app := newTestApplication(t)
+
+	sub, _, err := app.events.Subscribe("")
+	assert.NilError(t, err)
+	defer sub.Close()
+
+	s, err := app.snippets.Get(6)
+	assert.NilError(t, err)
+
+	// not published yet
+	until := app.publishScheduled(s.Published.Add(-time.Minute), s.Published.Add(-time.Second))
+	assert.Equal(t, until.Equal(s.Published.Add(-time.Second)), true)
+	assert.Equal(t, len(sub.C), 0)
+
+	until = app.publishScheduled(until, s.Published)
+	assert.Equal(t, until.Equal(s.Published), true)
+	assert.Equal(t, len(sub.C), 1)
+
+	e := <-sub.C
+	assert.Equal(t, e.Type, eventSnippet)
+	assert.StringContains(t, e.Data, `"title":"Release notes"`)
+}
@@ -0,0 +1,183 @@
+// Package events fans events out to subscribers in the same process, for
+// streaming them to browsers as server-sent events. Every subscriber has a
+// small buffer; one that falls further behind than that is dropped rather
+// than holding up everyone else, and can resume from the last event it saw
+// out of a short history, the way EventSource reconnects with
+// Last-Event-ID.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClosed = errors.New("events: broker is closed")
+	ErrSlow = errors.New("events: subscriber fell too far behind")
+)
+
+type Event struct {
+	// unique for the life of the Broker, see Broker.Subscribe
+	ID string
+	// the SSE event name, "message" if it's empty
+	Type string
+	Data string
+}
+
+// writes e in the text/event-stream format
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "id: %s\n", e.ID)
+	if e.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Type)
+	}
+	// a data field can't contain a newline, each line gets its own
+	for _, line := range strings.Split(e.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+type Broker struct {
+	// events a subscriber can fall behind by before it's dropped
+	buffer int
+	// events kept for subscribers that resume
+	historySize int
+
+	mu sync.Mutex
+	// tells this broker's event IDs from those of a previous run, after a
+	// restart there's nothing to resume from
+	epoch string
+	seq uint64
+	history []Event
+	subs map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBroker(buffer, history int) *Broker {
+	return &Broker{
+		buffer: buffer,
+		historySize: history,
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// a subscriber's stream of events
+type Subscription struct {
+	// closed once the subscriber has been dropped, Err says why
+	C <-chan Event
+
+	c chan Event
+	b *Broker
+	err error
+}
+
+// why C was closed, nil while it's open or if it was closed with Close
+func (s *Subscription) Err() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	return s.err
+}
+
+// unsubscribes, closing C
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	s.b.drop(s, nil)
+}
+
+// sends an event to every subscriber and returns it. Subscribers whose
+// buffer is full are dropped.
+func (b *Broker) Publish(typ, data string) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := Event{ID: b.epoch + "-" + strconv.FormatUint(b.seq, 10), Type: typ, Data: data}
+
+	if b.closed {
+		return e
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for s := range b.subs {
+		select {
+		case s.c <- e:
+		default:
+			b.drop(s, ErrSlow)
+		}
+	}
+
+	return e
+}
+
+// starts a subscription. lastID is the ID of the last event the subscriber
+// saw, from a previous subscription, and the events since then are returned
+// to be sent before anything from the subscription. If lastID is too old
+// or from before a restart, that's the whole history; if it's empty,
+// nothing.
+func (b *Broker) Subscribe(lastID string) (*Subscription, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, ErrClosed
+	}
+
+	var missed []Event
+	if lastID != "" {
+		missed = b.history
+		for i, e := range b.history {
+			if e.ID == lastID {
+				missed = b.history[i+1:]
+				break
+			}
+		}
+		// the history is trimmed by reslicing, so hand out a copy
+		missed = append([]Event(nil), missed...)
+	}
+
+	c := make(chan Event, b.buffer)
+	s := &Subscription{C: c, c: c, b: b}
+	b.subs[s] = struct{}{}
+
+	return s, missed, nil
+}
+
+// drops every subscriber and stops taking new ones, for shutting down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		b.drop(s, ErrClosed)
+	}
+}
+
+// removes s, must be called with b.mu held
+func (b *Broker) drop(s *Subscription, err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+
+	delete(b.subs, s)
+	s.err = err
+	close(s.c)
+}
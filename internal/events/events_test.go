@@ -0,0 +1,94 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+// returns the events waiting on s without blocking
+func drain(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventWriteTo(t *testing.T) {
+	var b strings.Builder
+
+	_, err := Event{ID: "a-1", Type: "snippet", Data: `{"id":1}`}.WriteTo(&b)
+	assert.NilError(t, err)
+	assert.Equal(t, b.String(), "id: a-1\nevent: snippet\ndata: {\"id\":1}\n\n")
+
+	b.Reset()
+
+	_, err = Event{ID: "a-2", Data: "two\nlines"}.WriteTo(&b)
+	assert.NilError(t, err)
+	assert.Equal(t, b.String(), "id: a-2\ndata: two\ndata: lines\n\n")
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(2, 3)
+
+	first, missed, err := b.Subscribe("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(missed), 0)
+
+	second, _, err := b.Subscribe("")
+	assert.NilError(t, err)
+
+	e1 := b.Publish("snippet", "1")
+
+	assert.Equal(t, drain(first)[0], e1)
+	assert.Equal(t, drain(second)[0], e1)
+
+	// second stops reading and falls behind
+	e2 := b.Publish("snippet", "2")
+	assert.Equal(t, drain(first)[0], e2)
+	b.Publish("snippet", "3")
+	assert.Equal(t, len(drain(first)), 1)
+	b.Publish("snippet", "4")
+
+	assert.Equal(t, len(drain(second)), 2)
+	_, ok := <-second.C
+	assert.Equal(t, ok, false)
+	assert.Equal(t, second.Err(), ErrSlow)
+
+	// and resumes from the last event it saw
+	resumed, missed, err := b.Subscribe(e2.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(missed), 2)
+	assert.Equal(t, missed[0].Data, "3")
+	assert.Equal(t, missed[1].Data, "4")
+	resumed.Close()
+
+	// from too long ago, or a previous run, it gets everything there is
+	_, missed, err = b.Subscribe(e1.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(missed), 3)
+	_, missed, err = b.Subscribe("before-a-restart-1")
+	assert.NilError(t, err)
+	assert.Equal(t, len(missed), 3)
+
+	first.Close()
+	assert.Equal(t, first.Err(), nil)
+	// closing twice is fine
+	first.Close()
+
+	b.Close()
+	_, ok = <-resumed.C
+	assert.Equal(t, ok, false)
+
+	_, _, err = b.Subscribe("")
+	assert.Equal(t, err, ErrClosed)
+}
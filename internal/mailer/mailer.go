@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To string
+	Subject string
+	Body string
+}
+
+// interface for sending emails so the SMTP implementation can be
+// swapped out for an in-memory one in tests
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// sends emails through an SMTP server
+type SMTP struct {
+	Host string
+	Port int
+	Username string
+	Password string
+	Sender string
+}
+
+func (m *SMTP) Send(msg Message) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+
+	// only authenticate if credentials were given (i.e. not a local relay)
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(addr, auth, m.Sender, []string{msg.To}, m.format(msg))
+}
+
+// builds a plain-text RFC 5322 message with the headers most servers expect
+func (m *SMTP) format(msg Message) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.Sender)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+
+	return buf.Bytes()
+}
+
+// keeps sent emails in memory instead of delivering them, for tests
+type Memory struct {
+	mu sync.Mutex
+	sent []Message
+}
+
+func (m *Memory) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// returns a copy of every email sent so far
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sent := make([]Message, len(m.sent))
+	copy(sent, m.sent)
+	return sent
+}
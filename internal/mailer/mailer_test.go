@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestSMTPFormat(t *testing.T) {
+	m := &SMTP{Sender: "Snippetbox <no-reply@example.com>"}
+
+	msg := string(m.format(Message{
+		To: "alice@example.com",
+		Subject: "Hello",
+		Body: "Hi Alice",
+	}))
+
+	assert.StringContains(t, msg, "From: Snippetbox <no-reply@example.com>\r\n")
+	assert.StringContains(t, msg, "To: alice@example.com\r\n")
+	assert.StringContains(t, msg, "Subject: Hello\r\n")
+	assert.Equal(t, strings.HasSuffix(msg, "\r\n\r\nHi Alice"), true)
+}
+
+func TestMemory(t *testing.T) {
+	m := &Memory{}
+
+	err := m.Send(Message{To: "alice@example.com", Subject: "One"})
+	assert.NilError(t, err)
+	err = m.Send(Message{To: "bob@example.com", Subject: "Two"})
+	assert.NilError(t, err)
+
+	sent := m.Sent()
+	assert.Equal(t, len(sent), 2)
+	assert.Equal(t, sent[1].To, "bob@example.com")
+}
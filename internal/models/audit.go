@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// admin and moderator actions recorded in the audit log
+const (
+	AuditUserRole = "user.role"
+	AuditUserDisable = "user.disable"
+	AuditUserEnable = "user.enable"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditSnippetHide = "snippet.hide"
+	AuditSnippetUnhide = "snippet.unhide"
+	AuditSnippetDelete = "snippet.delete"
+	AuditReportDismiss = "report.dismiss"
+	AuditSnippetRelease = "snippet.release"
+)
+
+// kinds of thing an audit entry can be about
+const (
+	AuditTargetUser = "user"
+	AuditTargetSnippet = "snippet"
+)
+
+type AuditEntry struct {
+	ID int
+	ActorID int
+	Action string
+	TargetType string
+	TargetID int
+	Details string
+	Created time.Time
+}
+
+// interface for the append-only log of privileged actions
+type AuditModelInterface interface {
+	Insert(actorID int, action, targetType string, targetID int, details string) error
+	Recent(limit int) ([]AuditEntry, error)
+}
+
+// implements AuditModelInterface
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// adds an entry to the 'audit_log' table
+func (m *AuditModel) Insert(actorID int, action, targetType string, targetID int, details string) error {
+	stmt := `INSERT INTO audit_log (actor_id, action, target_type, target_id, details, created)
+	VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, actorID, action, targetType, targetID, details)
+	return err
+}
+
+// returns the most recent entries, newest first
+func (m *AuditModel) Recent(limit int) ([]AuditEntry, error) {
+	stmt := `SELECT id, actor_id, action, target_type, target_id, details, created FROM audit_log
+	ORDER BY id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+
+	for rows.Next() {
+		var e AuditEntry
+
+		err = rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.Details, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
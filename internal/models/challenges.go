@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// remembers used proof-of-work challenges in the 'used_challenges' table so
+// one can't be replayed against another instance, implements pow.Store
+type ChallengeModel struct {
+	DB *sql.DB
+}
+
+// marks the challenge used, the primary key makes the first caller win
+func (m *ChallengeModel) Use(ctx context.Context, id string, expires time.Time) (bool, error) {
+	stmt := `INSERT IGNORE INTO used_challenges (id, expires) VALUES (?, ?)`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, expires.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// deletes challenges that expired before now, they'd be refused anyway
+func (m *ChallengeModel) Cleanup(ctx context.Context, now time.Time) error {
+	stmt := `DELETE FROM used_challenges WHERE expires < ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, now.UTC())
+	return err
+}
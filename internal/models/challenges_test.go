@@ -0,0 +1,39 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestChallengeModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	db := newTestDB(t)
+	m := ChallengeModel{db}
+
+	fresh, err := m.Use(ctx, "a", now.Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, fresh, true)
+
+	fresh, err = m.Use(ctx, "a", now.Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, fresh, false)
+
+	_, err = m.Use(ctx, "b", now.Add(time.Hour))
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.Cleanup(ctx, now.Add(2*time.Minute)))
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM used_challenges").Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// a half-written snippet, autosaved from the create form. Drafts are only
+// ever shown to the user who wrote them.
+type Draft struct {
+	ID int
+	UserID int
+	Title string
+	Content string
+	Created time.Time
+	Updated time.Time
+}
+
+// interface for users' snippet drafts
+type DraftModelInterface interface {
+	Insert(userID int, title, content string) (int, error)
+	Update(id, userID int, title, content string) error
+	Get(id, userID int) (Draft, error)
+	ByUser(userID, limit, offset int) ([]Draft, error)
+	Count(userID int) (int, error)
+	Delete(id, userID int) error
+}
+
+// implements DraftModelInterface
+type DraftModel struct {
+	DB *sql.DB
+}
+
+// adds a draft for userID, returns the new draft's ID
+func (m *DraftModel) Insert(userID int, title, content string) (int, error) {
+	stmt := `INSERT INTO drafts (user_id, title, content, created, updated)
+	VALUES (?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, userID, title, content)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// overwrites one of userID's drafts, returns ErrNoRecord if it isn't theirs
+func (m *DraftModel) Update(id, userID int, title, content string) error {
+	stmt := `UPDATE drafts SET title = ?, content = ?, updated = UTC_TIMESTAMP() WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, title, content, id, userID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL only counts changed rows, so check the draft exists if nothing changed
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		err = m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM drafts WHERE id = ? AND user_id = ?)`, id, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// returns one of userID's drafts, ErrNoRecord if it isn't theirs
+func (m *DraftModel) Get(id, userID int) (Draft, error) {
+	stmt := `SELECT id, user_id, title, content, created, updated FROM drafts WHERE id = ? AND user_id = ?`
+
+	var d Draft
+
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&d.ID, &d.UserID, &d.Title, &d.Content, &d.Created, &d.Updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Draft{}, ErrNoRecord
+		}
+		return Draft{}, err
+	}
+
+	return d, nil
+}
+
+// returns a page of a user's drafts, most recently saved first
+func (m *DraftModel) ByUser(userID, limit, offset int) ([]Draft, error) {
+	stmt := `SELECT id, user_id, title, content, created, updated FROM drafts
+	WHERE user_id = ? ORDER BY updated DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+
+	for rows.Next() {
+		var d Draft
+
+		err = rows.Scan(&d.ID, &d.UserID, &d.Title, &d.Content, &d.Created, &d.Updated)
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// returns how many drafts a user has
+func (m *DraftModel) Count(userID int) (int, error) {
+	var n int
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM drafts WHERE user_id = ?`, userID).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// deletes one of userID's drafts, returns ErrNoRecord if it isn't theirs
+func (m *DraftModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM drafts WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestDraftModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := DraftModel{db}
+
+	id, err := m.Insert(1, "Deploy runbook", "1. Take a")
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.Update(id, 1, "Deploy runbook", "1. Take a deep breath"))
+	// unchanged
+	assert.NilError(t, m.Update(id, 1, "Deploy runbook", "1. Take a deep breath"))
+
+	d, err := m.Get(id, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, d.Content, "1. Take a deep breath")
+
+	// only for their author
+	_, err = m.Get(id, 2)
+	assert.Equal(t, err, ErrNoRecord)
+	assert.Equal(t, m.Update(id, 2, "Mine now", ""), ErrNoRecord)
+	assert.Equal(t, m.Delete(id, 2), ErrNoRecord)
+
+	_, err = m.Insert(1, "", "Half a thought")
+	assert.NilError(t, err)
+
+	drafts, err := m.ByUser(1, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(drafts), 2)
+	drafts, err = m.ByUser(2, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(drafts), 0)
+
+	n, err := m.Count(1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+
+	assert.NilError(t, m.Delete(id, 1))
+	assert.Equal(t, m.Delete(id, 1), ErrNoRecord)
+
+	n, err = m.Count(1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+}
@@ -13,4 +13,13 @@ var (
 
 	// error for when a user tries to signup with an email address that already exists
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// error for when a user tries to signup with a handle that already exists
+	ErrDuplicateHandle = errors.New("models: duplicate handle")
+
+	// error for when an external (SSO) account is already linked to a different user
+	ErrDuplicateExternalID = errors.New("models: duplicate external ID")
+
+	// error for when a disabled user logs in with the correct password
+	ErrAccountDisabled = errors.New("models: account disabled")
 )
\ No newline at end of file
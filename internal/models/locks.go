@@ -0,0 +1,47 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+type LockModelInterface interface {
+	TryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+}
+
+// MySQL advisory locks, for work that only one instance of the app should
+// be doing at a time
+type LockModel struct {
+	DB *sql.DB
+}
+
+// runs fn while holding the named lock, returns false without running it if
+// another connection holds the lock. The lock belongs to a connection, so
+// one is kept aside until fn returns.
+func (m *LockModel) TryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// 1 if we got it, 0 if it's taken, NULL on error
+	var got sql.NullInt64
+
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, name).Scan(&got)
+	if err != nil {
+		return false, err
+	}
+	if got.Int64 != 1 {
+		return false, nil
+	}
+
+	// released once fn returns, even if ctx has been cancelled. The call has
+	// to be inside a closure, a deferred method call evaluates its receiver
+	// straight away and would release the lock before fn ran.
+	defer func() {
+		conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, name)
+	}()
+
+	return true, fn(ctx)
+}
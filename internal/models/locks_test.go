@@ -0,0 +1,44 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestLockModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	m := LockModel{db}
+
+	var ran, nestedRan bool
+
+	locked, err := m.TryLock(ctx, "test", func(ctx context.Context) error {
+		ran = true
+
+		// held by another connection
+		nested, err := m.TryLock(ctx, "test", func(ctx context.Context) error {
+			nestedRan = true
+			return nil
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, nested, false)
+
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, locked, true)
+	assert.Equal(t, ran, true)
+	assert.Equal(t, nestedRan, false)
+
+	// released
+	locked, err = m.TryLock(ctx, "test", func(ctx context.Context) error { return nil })
+	assert.NilError(t, err)
+	assert.Equal(t, locked, true)
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// kinds of login event
+const (
+	LoginEventSuccess = "success"
+	LoginEventFailure = "failure"
+	LoginEventThrottled = "throttled"
+	LoginEventLockout = "lockout"
+	LoginEventUnlock = "unlock"
+)
+
+type LoginEvent struct {
+	ID int
+	Email string
+	IP string
+	Kind string
+	Created time.Time
+}
+
+// failed login counts for an account and an IP address within a time window
+type LoginFailures struct {
+	Email int
+	LastEmail time.Time
+	IP int
+	LastIP time.Time
+}
+
+// interface for tracking login attempts and account lockouts, accounts are
+// keyed by the email address typed in (whether or not a user has it) so
+// responses don't reveal which addresses are registered
+type LoginAttemptModelInterface interface {
+	Record(email, ip, kind string) error
+	Failures(email, ip string, since time.Time) (LoginFailures, error)
+	Lock(email string, until time.Time) error
+	LockedUntil(email string) (time.Time, error)
+	Unlock(email string) error
+	Recent(limit int) ([]LoginEvent, error)
+}
+
+// implements LoginAttemptModelInterface
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// adds an event to the 'login_events' table
+func (m *LoginAttemptModel) Record(email, ip, kind string) error {
+	// microsecond precision so a failure straight after a success
+	// (in the same second) is still ordered correctly
+	stmt := `INSERT INTO login_events (email, ip, kind, created)
+	VALUES (?, ?, ?, UTC_TIMESTAMP(6))`
+
+	_, err := m.DB.Exec(stmt, email, ip, kind)
+	return err
+}
+
+// counts failures since a given time, failures for an account only count
+// if they happened after its last successful login or unlock
+func (m *LoginAttemptModel) Failures(email, ip string, since time.Time) (LoginFailures, error) {
+	var f LoginFailures
+	var lastEmail, lastIP sql.NullTime
+
+	stmt := `SELECT COUNT(*), MAX(created) FROM login_events
+	WHERE kind = 'failure' AND email = ? AND created > GREATEST(?, COALESCE(
+		(SELECT MAX(created) FROM login_events WHERE email = ? AND kind IN ('success', 'unlock')), ?))`
+
+	err := m.DB.QueryRow(stmt, email, since.UTC(), email, since.UTC()).Scan(&f.Email, &lastEmail)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_events
+	WHERE kind = 'failure' AND ip = ? AND created > ?`
+
+	err = m.DB.QueryRow(stmt, ip, since.UTC()).Scan(&f.IP, &lastIP)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+
+	f.LastEmail = lastEmail.Time
+	f.LastIP = lastIP.Time
+
+	return f, nil
+}
+
+// locks an account until the given time
+func (m *LoginAttemptModel) Lock(email string, until time.Time) error {
+	stmt := `INSERT INTO login_lockouts (email, locked_until) VALUES (?, ?)
+	ON DUPLICATE KEY UPDATE locked_until = VALUES(locked_until)`
+
+	_, err := m.DB.Exec(stmt, email, until.UTC())
+	return err
+}
+
+// returns when an account's lockout ends, or the zero time if it isn't locked
+func (m *LoginAttemptModel) LockedUntil(email string) (time.Time, error) {
+	stmt := `SELECT MAX(locked_until) FROM login_lockouts
+	WHERE email = ? AND locked_until > UTC_TIMESTAMP()`
+
+	var until sql.NullTime
+
+	err := m.DB.QueryRow(stmt, email).Scan(&until)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return until.Time, nil
+}
+
+// lifts a lockout early
+func (m *LoginAttemptModel) Unlock(email string) error {
+	_, err := m.DB.Exec(`DELETE FROM login_lockouts WHERE email = ?`, email)
+	return err
+}
+
+// returns the most recent login events, newest first
+func (m *LoginAttemptModel) Recent(limit int) ([]LoginEvent, error) {
+	stmt := `SELECT id, email, ip, kind, created FROM login_events
+	ORDER BY id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []LoginEvent
+
+	for rows.Next() {
+		var e LoginEvent
+
+		err = rows.Scan(&e.ID, &e.Email, &e.IP, &e.Kind, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// in-memory implementation of models.AuditModelInterface, keeps every entry
+// so tests can check what was logged
+type AuditModel struct {
+	mu sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (m *AuditModel) Insert(actorID int, action, targetType string, targetID int, details string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, models.AuditEntry{
+		ID: len(m.entries) + 1,
+		ActorID: actorID,
+		Action: action,
+		TargetType: targetType,
+		TargetID: targetID,
+		Details: details,
+		Created: time.Now(),
+	})
+	return nil
+}
+
+func (m *AuditModel) Recent(limit int) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, m.entries[i])
+	}
+
+	return entries, nil
+}
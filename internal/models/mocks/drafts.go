@@ -0,0 +1,110 @@
+package mocks
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// in-memory implementation of models.DraftModelInterface, keeps state so
+// autosaving can be tested end-to-end
+type DraftModel struct {
+	mu sync.Mutex
+	drafts []models.Draft
+	nextID int
+}
+
+func (m *DraftModel) Insert(userID int, title, content string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	m.drafts = append(m.drafts, models.Draft{
+		ID: m.nextID,
+		UserID: userID,
+		Title: title,
+		Content: content,
+		Created: time.Now(),
+		Updated: time.Now(),
+	})
+
+	return m.nextID, nil
+}
+
+func (m *DraftModel) Update(id, userID int, title, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, d := range m.drafts {
+		if d.ID == id && d.UserID == userID {
+			m.drafts[i].Title = title
+			m.drafts[i].Content = content
+			m.drafts[i].Updated = time.Now()
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *DraftModel) Get(id, userID int) (models.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.drafts {
+		if d.ID == id && d.UserID == userID {
+			return d, nil
+		}
+	}
+
+	return models.Draft{}, models.ErrNoRecord
+}
+
+func (m *DraftModel) ByUser(userID, limit, offset int) ([]models.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// most recently saved first
+	var drafts []models.Draft
+	for i := len(m.drafts) - 1; i >= 0; i-- {
+		if m.drafts[i].UserID == userID {
+			drafts = append(drafts, m.drafts[i])
+		}
+	}
+
+	if offset >= len(drafts) {
+		return nil, nil
+	}
+
+	return drafts[offset:min(len(drafts), offset+limit)], nil
+}
+
+func (m *DraftModel) Count(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, d := range m.drafts {
+		if d.UserID == userID {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (m *DraftModel) Delete(id, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, d := range m.drafts {
+		if d.ID == id && d.UserID == userID {
+			m.drafts = slices.Delete(m.drafts, i, i+1)
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+)
+
+// a lock only this process can take, Held simulates another instance having it
+type LockModel struct {
+	mu sync.Mutex
+	Held bool
+}
+
+func (m *LockModel) TryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	m.mu.Lock()
+	if m.Held {
+		m.mu.Unlock()
+		return false, nil
+	}
+	m.Held = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.Held = false
+		m.mu.Unlock()
+	}()
+
+	return true, fn(ctx)
+}
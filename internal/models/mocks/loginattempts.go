@@ -0,0 +1,103 @@
+package mocks
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// in-memory implementation of models.LoginAttemptModelInterface, unlike the
+// other mocks it keeps state so the login throttling can be tested end-to-end
+type LoginAttemptModel struct {
+	mu sync.Mutex
+	events []models.LoginEvent
+	lockouts map[string]time.Time
+}
+
+func (m *LoginAttemptModel) Record(email, ip, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, models.LoginEvent{
+		ID: len(m.events) + 1,
+		Email: email,
+		IP: ip,
+		Kind: kind,
+		Created: time.Now(),
+	})
+	return nil
+}
+
+func (m *LoginAttemptModel) Failures(email, ip string, since time.Time) (models.LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	emailSince := since
+	for _, e := range m.events {
+		if e.Email == email && (e.Kind == models.LoginEventSuccess || e.Kind == models.LoginEventUnlock) && e.Created.After(emailSince) {
+			emailSince = e.Created
+		}
+	}
+
+	var f models.LoginFailures
+
+	for _, e := range m.events {
+		if e.Kind != models.LoginEventFailure {
+			continue
+		}
+		if e.Email == email && e.Created.After(emailSince) {
+			f.Email++
+			f.LastEmail = e.Created
+		}
+		if e.IP == ip && e.Created.After(since) {
+			f.IP++
+			f.LastIP = e.Created
+		}
+	}
+
+	return f, nil
+}
+
+func (m *LoginAttemptModel) Lock(email string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lockouts == nil {
+		m.lockouts = map[string]time.Time{}
+	}
+	m.lockouts[email] = until
+	return nil
+}
+
+func (m *LoginAttemptModel) LockedUntil(email string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until := m.lockouts[email]
+	if until.Before(time.Now()) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+func (m *LoginAttemptModel) Unlock(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.lockouts, email)
+	return nil
+}
+
+func (m *LoginAttemptModel) Recent(limit int) ([]models.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := slices.Clone(m.events)
+	slices.Reverse(events)
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
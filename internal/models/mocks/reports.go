@@ -0,0 +1,122 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// in-memory implementation of models.ReportModelInterface, keeps state so
+// the report rate limits and moderation queue can be tested end-to-end
+type ReportModel struct {
+	mu sync.Mutex
+	reports []models.Report
+}
+
+func (m *ReportModel) Insert(snippetID, reporterID int, reason, note string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := models.Report{
+		ID: len(m.reports) + 1,
+		SnippetID: snippetID,
+		ReporterID: reporterID,
+		Reason: reason,
+		Note: note,
+		Status: models.ReportStatusOpen,
+		Created: time.Now(),
+	}
+	if snippetID == mockSnippet.ID {
+		r.SnippetTitle = mockSnippet.Title
+		r.SnippetUserID = mockSnippet.UserID
+	}
+
+	m.reports = append(m.reports, r)
+	return r.ID, nil
+}
+
+func (m *ReportModel) Get(id int) (models.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.reports) {
+		return models.Report{}, models.ErrNoRecord
+	}
+
+	return m.reports[id-1], nil
+}
+
+func (m *ReportModel) Open(limit, offset int) ([]models.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var open []models.Report
+	for _, r := range m.reports {
+		if r.Status == models.ReportStatusOpen {
+			open = append(open, r)
+		}
+	}
+
+	if offset >= len(open) {
+		return nil, nil
+	}
+
+	return open[offset:min(len(open), offset+limit)], nil
+}
+
+func (m *ReportModel) HasOpen(snippetID, reporterID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.reports {
+		if r.SnippetID == snippetID && r.ReporterID == reporterID && r.Status == models.ReportStatusOpen {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *ReportModel) CountSince(reporterID int, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, r := range m.reports {
+		if r.ReporterID == reporterID && r.Created.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *ReportModel) Resolve(id, moderatorID int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.reports) || m.reports[id-1].Status != models.ReportStatusOpen {
+		return models.ErrNoRecord
+	}
+
+	m.reports[id-1].Status = status
+	m.reports[id-1].ResolvedBy = moderatorID
+	m.reports[id-1].Resolved = time.Now()
+	return nil
+}
+
+func (m *ReportModel) ResolveAllForSnippet(snippetID, moderatorID int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, r := range m.reports {
+		if r.SnippetID == snippetID && r.Status == models.ReportStatusOpen {
+			m.reports[i].Status = status
+			m.reports[i].ResolvedBy = moderatorID
+			m.reports[i].Resolved = time.Now()
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package mocks
 
 import (
+	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"snippetbox.derrc/internal/models"
@@ -8,15 +11,70 @@ import (
 
 var mockSnippet = models.Snippet{
 	ID: 1,
+	UserID: 1,
 	Title: "An old silent pond",
 	Content: "An old silent pond...",
 	Created: time.Now(),
+	Published: time.Now(),
 	Expires: time.Now(),
 }
 
-type SnippetModel struct{}
+// hidden by a moderator
+var mockHiddenSnippet = models.Snippet{
+	ID: 3,
+	UserID: 1,
+	Title: "Buy cheap watches",
+	Content: "Buy cheap watches...",
+	Created: time.Now(),
+	Published: time.Now(),
+	Expires: time.Now(),
+	Hidden: true,
+}
+
+// held back by the spam filter
+var mockHeldSnippet = models.Snippet{
+	ID: 4,
+	UserID: 1,
+	Title: "Cheap flights",
+	Content: "Cheap flights...",
+	Created: time.Now(),
+	Published: time.Now(),
+	Expires: time.Now(),
+	Held: true,
+}
+
+// in its author's trash
+var mockTrashedSnippet = models.Snippet{
+	ID: 5,
+	UserID: 1,
+	Title: "Deploy runbook",
+	Content: "1. Take a deep breath...",
+	Created: time.Now(),
+	Published: time.Now(),
+	Expires: time.Now(),
+	Deleted: time.Now(),
+}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// waiting to be published tomorrow
+var mockScheduledSnippet = models.Snippet{
+	ID: 6,
+	UserID: 1,
+	Title: "Release notes",
+	Content: "Version 2 is out...",
+	Created: time.Now(),
+	Published: time.Now().Add(24 * time.Hour),
+}
+
+type SnippetModel struct {
+	mu sync.Mutex
+	// expired snippets waiting to be purged
+	Expired int
+	// snippets that have been in the trash for longer than the retention
+	// window, waiting to be purged
+	TrashExpired int
+}
+
+func (m *SnippetModel) Insert(userID int, title string, content string, published, expires time.Time, held bool) (int, error) {
 	return 2, nil
 }
 
@@ -24,6 +82,12 @@ func (m *SnippetModel) Get(id int) (models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockHiddenSnippet, nil
+	case 4:
+		return mockHeldSnippet, nil
+	case 6:
+		return mockScheduledSnippet, nil
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
@@ -32,3 +96,141 @@ func (m *SnippetModel) Get(id int) (models.Snippet, error) {
 func (m *SnippetModel) Latest() ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ByUser(userID, limit, offset int) ([]models.Snippet, error) {
+	if userID == 1 && offset == 0 {
+		return []models.Snippet{mockSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *SnippetModel) List(search string, limit, offset int) ([]models.Snippet, error) {
+	if offset == 0 && strings.Contains(mockSnippet.Title, search) {
+		return []models.Snippet{mockSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	if id != 1 && id != 3 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) SetHeld(id int, held bool) error {
+	if id != 1 && id != 4 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) SetExpires(id int, expires time.Time) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Scheduled(userID, limit, offset int) ([]models.Snippet, error) {
+	if userID == 1 && offset == 0 {
+		return []models.Snippet{mockScheduledSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *SnippetModel) SetPublished(id, userID int, published time.Time) error {
+	if id != 6 || userID != 1 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) PublishedBetween(after, until time.Time) ([]models.Snippet, error) {
+	if mockScheduledSnippet.Published.After(after) && !mockScheduledSnippet.Published.After(until) {
+		return []models.Snippet{mockScheduledSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	if id != 1 && id != 3 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := min(limit, m.Expired)
+	m.Expired -= n
+
+	return n, nil
+}
+
+func (m *SnippetModel) Trash(id int) error {
+	if id != 1 && id != 3 && id != 4 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Trashed(userID, limit, offset int) ([]models.Snippet, error) {
+	if userID == 1 && offset == 0 {
+		return []models.Snippet{mockTrashedSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *SnippetModel) Restore(id, userID int) error {
+	if id != 5 || userID != 1 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) DeleteTrashed(id, userID int) error {
+	if id != 5 || userID != 1 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) PurgeTrash(ctx context.Context, before time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := min(limit, m.TrashExpired)
+	m.TrashExpired -= n
+
+	return n, nil
+}
+
+func (m *SnippetModel) CountsByDay(days int) ([]models.DailyCount, error) {
+	return []models.DailyCount{
+		{Day: time.Now().UTC().Truncate(24 * time.Hour), Count: 1},
+	}, nil
+}
+
+func (m *SnippetModel) Usage(userID int) (models.SnippetUsage, error) {
+	if userID == 1 {
+		return models.SnippetUsage{Count: 3, Bytes: 2048}, nil
+	}
+
+	return models.SnippetUsage{}, nil
+}
@@ -0,0 +1,85 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+	"snippetbox.derrc/internal/spam"
+)
+
+// in-memory implementation of models.SpamModelInterface, the classifier's
+// counts are kept in a spam.MemoryStore so training can be tested end-to-end
+type SpamModel struct {
+	spam.MemoryStore
+
+	mu sync.Mutex
+	reviews []models.SpamReview
+}
+
+func (m *SpamModel) Queue(snippetID int, score float64, reasons string, held bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sr := models.SpamReview{
+		ID: len(m.reviews) + 1,
+		SnippetID: snippetID,
+		Score: score,
+		Reasons: reasons,
+		Held: held,
+		Created: time.Now(),
+	}
+	switch snippetID {
+	case mockSnippet.ID:
+		sr.SnippetTitle, sr.SnippetUserID = mockSnippet.Title, mockSnippet.UserID
+	case mockHeldSnippet.ID:
+		sr.SnippetTitle, sr.SnippetUserID = mockHeldSnippet.Title, mockHeldSnippet.UserID
+	}
+
+	m.reviews = append(m.reviews, sr)
+	return sr.ID, nil
+}
+
+func (m *SpamModel) GetReview(id int) (models.SpamReview, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.reviews) {
+		return models.SpamReview{}, models.ErrNoRecord
+	}
+
+	return m.reviews[id-1], nil
+}
+
+func (m *SpamModel) Pending(limit, offset int) ([]models.SpamReview, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []models.SpamReview
+	for _, sr := range m.reviews {
+		if sr.Decision == "" {
+			pending = append(pending, sr)
+		}
+	}
+
+	if offset >= len(pending) {
+		return nil, nil
+	}
+
+	return pending[offset:min(len(pending), offset+limit)], nil
+}
+
+func (m *SpamModel) Resolve(id, moderatorID int, decision string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.reviews) || m.reviews[id-1].Decision != "" {
+		return models.ErrNoRecord
+	}
+
+	m.reviews[id-1].Decision = decision
+	m.reviews[id-1].ResolvedBy = moderatorID
+	m.reviews[id-1].Resolved = time.Now()
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package mocks
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+type TokenModel struct{}
+
+func (m *TokenModel) New(userID int, ttl time.Duration, scope string) (models.Token, error) {
+	hash := sha256.Sum256([]byte("validToken"))
+
+	return models.Token{
+		Plaintext: "validToken",
+		Hash: hash[:],
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope: scope,
+	}, nil
+}
+
+func (m *TokenModel) Check(plaintext, scope string) (int, error) {
+	if plaintext == "validToken" {
+		return 1, nil
+	}
+
+	return 0, models.ErrNoRecord
+}
+
+func (m *TokenModel) Consume(plaintext, scope string) (int, error) {
+	return m.Check(plaintext, scope)
+}
+
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	return nil
+}
+
+func (m *TokenModel) LastCreated(scope string, userID int) (time.Time, error) {
+	return time.Time{}, nil
+}
@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"snippetbox.derrc/internal/models"
+)
+
+// secret for the mock user with two-factor enabled
+const MockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+type TwoFactorModel struct{}
+
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	if userID == 3 {
+		return MockTOTPSecret, nil
+	}
+
+	return "", models.ErrNoRecord
+}
+
+func (m *TwoFactorModel) UseStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	return userID == 3 && code == "validrecovery", nil
+}
+
+func (m *TwoFactorModel) RecoveryCodesRemaining(userID int) (int, error) {
+	return 10, nil
+}
@@ -1,17 +1,89 @@
 package mocks
 
 import (
+	"strings"
+	"time"
+
 	"snippetbox.derrc/internal/models"
 )
 
+var mockUser = models.User{
+	ID: 1,
+	Name: "Alice Jones",
+	Handle: "alice",
+	Email: "alice@example.com",
+	EmailVerified: true,
+	Role: models.RoleUser,
+	Created: time.Now(),
+}
+
+// has signed up but not yet verified their email address
+var mockUnverifiedUser = models.User{
+	ID: 2,
+	Name: "Bob Smith",
+	Handle: "bob",
+	Email: "bob@example.com",
+	Role: models.RoleUser,
+	Created: time.Now(),
+}
+
+// has two-factor authentication enabled (see TwoFactorModel) and is
+// linked to the SSO subject "carol-sso"
+var mockTwoFactorUser = models.User{
+	ID: 3,
+	Name: "Carol White",
+	Handle: "carol",
+	Email: "carol@example.com",
+	EmailVerified: true,
+	ExternalID: "carol-sso",
+	Role: models.RoleUser,
+	Created: time.Now(),
+}
+
+// has the admin role
+var mockAdminUser = models.User{
+	ID: 5,
+	Name: "Grace Hopper",
+	Handle: "grace",
+	Email: "grace@example.com",
+	EmailVerified: true,
+	Role: models.RoleAdmin,
+	Created: time.Now(),
+}
+
+// has the moderator role
+var mockModeratorUser = models.User{
+	ID: 6,
+	Name: "Heidi Lamarr",
+	Handle: "heidi",
+	Email: "heidi@example.com",
+	EmailVerified: true,
+	Role: models.RoleModerator,
+	Created: time.Now(),
+}
+
+// has been disabled by an admin
+var mockDisabledUser = models.User{
+	ID: 7,
+	Name: "Ivan Petrov",
+	Handle: "ivan",
+	Email: "ivan@example.com",
+	EmailVerified: true,
+	Role: models.RoleUser,
+	Disabled: true,
+	Created: time.Now(),
+}
+
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
-	switch email {
-	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+func (m *UserModel) Insert(name, handle, email, password string) (int, error) {
+	switch {
+	case email == "dupe@example.com":
+		return 0, models.ErrDuplicateEmail
+	case handle == "dupe":
+		return 0, models.ErrDuplicateHandle
 	default:
-		return nil
+		return 4, nil
 	}
 }
 
@@ -19,15 +91,172 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
 		return 1, nil
 	}
+	if email == "bob@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
+	if email == "carol@example.com" && password == "pa$$word" {
+		return 3, nil
+	}
+	if email == "grace@example.com" && password == "pa$$word" {
+		return 5, nil
+	}
+	if email == "heidi@example.com" && password == "pa$$word" {
+		return 6, nil
+	}
+	if email == "ivan@example.com" && password == "pa$$word" {
+		return 0, models.ErrAccountDisabled
+	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3, 5, 6, 7:
 		return true, nil
 	default:
 		return false, nil
 	}
-}
\ No newline at end of file
+}
+
+func (m *UserModel) Get(id int) (models.User, error) {
+	switch id {
+	case 1:
+		return mockUser, nil
+	case 2:
+		return mockUnverifiedUser, nil
+	case 3:
+		return mockTwoFactorUser, nil
+	case 5:
+		return mockAdminUser, nil
+	case 6:
+		return mockModeratorUser, nil
+	case 7:
+		return mockDisabledUser, nil
+	default:
+		return models.User{}, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) GetByHandle(handle string) (models.User, error) {
+	switch handle {
+	case "alice":
+		return mockUser, nil
+	case "bob":
+		return mockUnverifiedUser, nil
+	case "carol":
+		return mockTwoFactorUser, nil
+	case "grace":
+		return mockAdminUser, nil
+	case "heidi":
+		return mockModeratorUser, nil
+	case "ivan":
+		return mockDisabledUser, nil
+	default:
+		return models.User{}, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) UpdateName(id int, name string) error {
+	return nil
+}
+
+func (m *UserModel) UpdateEmail(id int, email string) error {
+	switch email {
+	case "dupe@example.com":
+		return models.ErrDuplicateEmail
+	default:
+		return nil
+	}
+}
+
+func (m *UserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
+	exists, _ := m.Exists(id)
+	if exists && currentPassword == "pa$$word" {
+		return nil
+	}
+
+	return models.ErrInvalidCredentials
+}
+
+func (m *UserModel) GetByEmail(email string) (models.User, error) {
+	switch email {
+	case "alice@example.com":
+		return mockUser, nil
+	case "bob@example.com":
+		return mockUnverifiedUser, nil
+	case "carol@example.com":
+		return mockTwoFactorUser, nil
+	case "grace@example.com":
+		return mockAdminUser, nil
+	case "heidi@example.com":
+		return mockModeratorUser, nil
+	case "ivan@example.com":
+		return mockDisabledUser, nil
+	default:
+		return models.User{}, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) SetPassword(id int, password string) error {
+	return nil
+}
+
+func (m *UserModel) SetEmailVerified(id int) error {
+	return nil
+}
+
+func (m *UserModel) InsertExternal(name, handle, email, externalID string) (int, error) {
+	switch handle {
+	case "alice", "bob", "carol", "grace", "heidi", "ivan", "dupe":
+		return 0, models.ErrDuplicateHandle
+	default:
+		return 4, nil
+	}
+}
+
+func (m *UserModel) GetByExternalID(externalID string) (models.User, error) {
+	switch externalID {
+	case "carol-sso":
+		return mockTwoFactorUser, nil
+	default:
+		return models.User{}, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) SetExternalID(id int, externalID string) error {
+	return nil
+}
+
+func (m *UserModel) SetRole(id int, role string) error {
+	exists, _ := m.Exists(id)
+	if !exists {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *UserModel) List(search string, limit, offset int) ([]models.User, error) {
+	if offset > 0 {
+		return nil, nil
+	}
+
+	var users []models.User
+	for _, u := range []models.User{mockDisabledUser, mockModeratorUser, mockAdminUser, mockTwoFactorUser, mockUnverifiedUser, mockUser} {
+		if strings.Contains(u.Name, search) || strings.Contains(u.Handle, search) || strings.Contains(u.Email, search) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	exists, _ := m.Exists(id)
+	if !exists {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package mocks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"snippetbox.derrc/internal/models"
+)
+
+// in-memory implementation of models.UserSessionModelInterface, keeps state
+// so that revoking sessions can be tested end-to-end
+type UserSessionModel struct {
+	mu sync.Mutex
+	next int
+	sessions []models.UserSession
+}
+
+func (m *UserSessionModel) Insert(userID int, ip, userAgent string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next++
+	id := fmt.Sprintf("session%d", m.next)
+
+	m.sessions = append(m.sessions, models.UserSession{
+		ID: id,
+		UserID: userID,
+		IP: ip,
+		UserAgent: userAgent,
+		Created: time.Now(),
+		LastSeen: time.Now(),
+	})
+	return id, nil
+}
+
+func (m *UserSessionModel) Touch(id string, userID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.sessions {
+		if m.sessions[i].ID == id && m.sessions[i].UserID == userID {
+			m.sessions[i].LastSeen = time.Now()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *UserSessionModel) ForUser(userID int) ([]models.UserSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.UserSession
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *UserSessionModel) Delete(id string, userID int) error {
+	return m.deleteWhere(func(s models.UserSession) bool {
+		return s.ID == id && s.UserID == userID
+	})
+}
+
+func (m *UserSessionModel) DeleteAllForUser(userID int, exceptID string) error {
+	return m.deleteWhere(func(s models.UserSession) bool {
+		return s.UserID == userID && s.ID != exceptID
+	})
+}
+
+func (m *UserSessionModel) deleteWhere(match func(models.UserSession) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.sessions[:0]
+	for _, s := range m.sessions {
+		if !match(s) {
+			kept = append(kept, s)
+		}
+	}
+	m.sessions = kept
+	return nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"snippetbox.derrc/internal/ratelimit"
+)
+
+// keeps rate limit buckets in the 'rate_limits' table so every instance of
+// the app shares them, implements ratelimit.Store
+type RateLimitModel struct {
+	DB *sql.DB
+}
+
+// takes a token from the bucket for key, the row is locked while it's
+// updated so concurrent requests can't both take the last token
+func (m *RateLimitModel) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	// make sure there's a row to lock, a new bucket starts full
+	stmt := `INSERT IGNORE INTO rate_limits (bucket_key, tokens, updated, full_at) VALUES (?, ?, ?, ?)`
+
+	_, err = tx.ExecContext(ctx, stmt, key, limit.Burst, now.UTC(), now.UTC())
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	var b ratelimit.Bucket
+
+	stmt = `SELECT tokens, updated FROM rate_limits WHERE bucket_key = ? FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, stmt, key).Scan(&b.Tokens, &b.Updated)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	res := b.Take(limit, now)
+
+	stmt = `UPDATE rate_limits SET tokens = ?, updated = ?, full_at = ? WHERE bucket_key = ?`
+
+	_, err = tx.ExecContext(ctx, stmt, b.Tokens, b.Updated.UTC(), b.FullAt(limit).UTC(), key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return res, nil
+}
+
+// deletes buckets that have been full since before now
+func (m *RateLimitModel) Cleanup(ctx context.Context, now time.Time) error {
+	stmt := `DELETE FROM rate_limits WHERE full_at < ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, now.UTC())
+	return err
+}
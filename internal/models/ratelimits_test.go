@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/ratelimit"
+)
+
+func TestRateLimitModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	ctx := context.Background()
+	limit := ratelimit.Limit{Burst: 2, Period: time.Minute}
+	now := time.Now().Truncate(time.Microsecond)
+
+	db := newTestDB(t)
+	m := RateLimitModel{db}
+
+	for _, want := range []bool{true, true, false} {
+		res, err := m.Take(ctx, "login:127.0.0.1", limit, now)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Allowed, want)
+	}
+
+	// refilled after half the period
+	res, err := m.Take(ctx, "login:127.0.0.1", limit, now.Add(30*time.Second))
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+
+	assert.NilError(t, m.Cleanup(ctx, now.Add(2*time.Minute)))
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM rate_limits").Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+}
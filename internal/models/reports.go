@@ -0,0 +1,183 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// reasons a snippet can be reported for
+const (
+	ReportReasonSpam = "spam"
+	ReportReasonAbuse = "abuse"
+	ReportReasonIllegal = "illegal"
+	ReportReasonPrivate = "private"
+	ReportReasonOther = "other"
+)
+
+// all report reasons, in the order they're offered
+var ReportReasons = []string{ReportReasonSpam, ReportReasonAbuse, ReportReasonIllegal, ReportReasonPrivate, ReportReasonOther}
+
+// report statuses, reports start open and are closed by a moderator
+const (
+	ReportStatusOpen = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned = "actioned"
+)
+
+type Report struct {
+	ID int
+	SnippetID int
+	ReporterID int
+	Reason string
+	Note string
+	Status string
+	Created time.Time
+	// zero until a moderator closes the report
+	ResolvedBy int
+	Resolved time.Time
+	// title and author of the reported snippet, for the moderation queue
+	SnippetTitle string
+	SnippetUserID int
+}
+
+// interface for abuse reports and the moderation queue
+type ReportModelInterface interface {
+	Insert(snippetID, reporterID int, reason, note string) (int, error)
+	Get(id int) (Report, error)
+	Open(limit, offset int) ([]Report, error)
+	HasOpen(snippetID, reporterID int) (bool, error)
+	CountSince(reporterID int, since time.Time) (int, error)
+	Resolve(id, moderatorID int, status string) error
+	ResolveAllForSnippet(snippetID, moderatorID int, status string) error
+}
+
+// implements ReportModelInterface
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// adds an open report to the 'reports' table, returns the new report's ID
+func (m *ReportModel) Insert(snippetID, reporterID int, reason, note string) (int, error) {
+	stmt := `INSERT INTO reports (snippet_id, reporter_id, reason, note, status, created)
+	VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, reporterID, reason, note, ReportStatusOpen)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// returns report with corresponding id
+func (m *ReportModel) Get(id int) (Report, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.reporter_id, r.reason, r.note, r.status, r.created,
+	COALESCE(r.resolved_by, 0), r.resolved, COALESCE(s.title, ''), COALESCE(s.user_id, 0)
+	FROM reports r LEFT JOIN snippets s ON s.id = r.snippet_id WHERE r.id = ?`
+
+	var rp Report
+	var resolved sql.NullTime
+
+	err := m.DB.QueryRow(stmt, id).Scan(&rp.ID, &rp.SnippetID, &rp.ReporterID, &rp.Reason, &rp.Note, &rp.Status, &rp.Created,
+		&rp.ResolvedBy, &resolved, &rp.SnippetTitle, &rp.SnippetUserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Report{}, ErrNoRecord
+		} else {
+			return Report{}, err
+		}
+	}
+	rp.Resolved = resolved.Time
+
+	return rp, nil
+}
+
+// returns a page of the moderation queue, oldest report first
+func (m *ReportModel) Open(limit, offset int) ([]Report, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.reporter_id, r.reason, r.note, r.status, r.created,
+	COALESCE(s.title, ''), COALESCE(s.user_id, 0)
+	FROM reports r LEFT JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.status = ? ORDER BY r.id LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, ReportStatusOpen, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+
+	for rows.Next() {
+		var rp Report
+
+		err = rows.Scan(&rp.ID, &rp.SnippetID, &rp.ReporterID, &rp.Reason, &rp.Note, &rp.Status, &rp.Created,
+			&rp.SnippetTitle, &rp.SnippetUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, rp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// reports whether a user already has an open report about a snippet
+func (m *ReportModel) HasOpen(snippetID, reporterID int) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM reports WHERE snippet_id = ? AND reporter_id = ? AND status = ?)`
+
+	err := m.DB.QueryRow(stmt, snippetID, reporterID, ReportStatusOpen).Scan(&exists)
+	return exists, err
+}
+
+// returns how many reports a user has made since the given time
+func (m *ReportModel) CountSince(reporterID int, since time.Time) (int, error) {
+	var count int
+
+	stmt := `SELECT COUNT(*) FROM reports WHERE reporter_id = ? AND created > ?`
+
+	err := m.DB.QueryRow(stmt, reporterID, since.UTC()).Scan(&count)
+	return count, err
+}
+
+// closes an open report, returns ErrNoRecord if there's no such open report
+func (m *ReportModel) Resolve(id, moderatorID int, status string) error {
+	stmt := `UPDATE reports SET status = ?, resolved_by = ?, resolved = UTC_TIMESTAMP()
+	WHERE id = ? AND status = ?`
+
+	result, err := m.DB.Exec(stmt, status, moderatorID, id, ReportStatusOpen)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// closes every open report about a snippet, i.e. once it has been hidden
+func (m *ReportModel) ResolveAllForSnippet(snippetID, moderatorID int, status string) error {
+	stmt := `UPDATE reports SET status = ?, resolved_by = ?, resolved = UTC_TIMESTAMP()
+	WHERE snippet_id = ? AND status = ?`
+
+	_, err := m.DB.Exec(stmt, status, moderatorID, snippetID, ReportStatusOpen)
+	return err
+}
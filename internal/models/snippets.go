@@ -1,24 +1,77 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
 type Snippet struct {
 	ID int
+	UserID int
 	Title string
 	Content string
 	Created time.Time
+	// when it becomes visible to anyone but its author, the same as Created
+	// unless it was scheduled
+	Published time.Time
+	// zero if the snippet never expires
 	Expires time.Time
+	// hidden by a moderator or admin, left out of public listings
+	Hidden bool
+	// held back by the spam filter until a moderator has looked at it, only
+	// its author and moderators can see it
+	Held bool
+	// when its author moved it to the trash, zero if they haven't. Trashed
+	// snippets are left out everywhere except the author's trash.
+	Deleted time.Time
+}
+
+// reports whether the snippet is waiting for its publication time
+func (s Snippet) IsScheduled() bool {
+	return s.Published.After(time.Now())
+}
+
+// number of snippets created on a day (UTC)
+type DailyCount struct {
+	Day time.Time
+	Count int
+}
+
+// what a user is storing, counted against their quota
+type SnippetUsage struct {
+	Count int
+	// title and content
+	Bytes int64
 }
 
 // interface for Snippet CRUD methods
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userID int, title string, content string, published, expires time.Time, held bool) (int, error)
 	Get(id int) (Snippet, error)
 	Latest() ([]Snippet, error)
+	ByUser(userID, limit, offset int) ([]Snippet, error)
+	List(search string, limit, offset int) ([]Snippet, error)
+	SetHidden(id int, hidden bool) error
+	SetHeld(id int, held bool) error
+	SetExpires(id int, expires time.Time) error
+	// snippets waiting for their publication time
+	Scheduled(userID, limit, offset int) ([]Snippet, error)
+	SetPublished(id, userID int, published time.Time) error
+	PublishedBetween(after, until time.Time) ([]Snippet, error)
+	Delete(id int) error
+	DeleteExpired(ctx context.Context, limit int) (int, error)
+	// the trash, where authors' deleted snippets are kept for a while
+	Trash(id int) error
+	Trashed(userID, limit, offset int) ([]Snippet, error)
+	Restore(id, userID int) error
+	DeleteTrashed(id, userID int) error
+	PurgeTrash(ctx context.Context, before time.Time, limit int) (int, error)
+	CountsByDay(days int) ([]DailyCount, error)
+	Usage(userID int) (SnippetUsage, error)
 }
 
 // implements SnippetModelInterface
@@ -26,12 +79,13 @@ type SnippetModel struct {
 		DB *sql.DB
 }
 
-// inserts snippet into 'snippets' table
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// inserts snippet into 'snippets' table, a zero published means it's
+// published straight away and a zero expires means it never expires
+func (m *SnippetModel) Insert(userID int, title string, content string, published, expires time.Time, held bool) (int, error) {
+	stmt := `INSERT INTO snippets (user_id, title, content, created, published, expires, held)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), COALESCE(?, UTC_TIMESTAMP()), ?, ?)`
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := m.DB.Exec(stmt, userID, title, content, sql.NullTime{Time: published.UTC(), Valid: !published.IsZero()}, sql.NullTime{Time: expires.UTC(), Valid: !expires.IsZero()}, held)
 	if err != nil {
 		return 0, err
 	}
@@ -44,17 +98,19 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	return int(id), nil
 }
 
-// returns snippet with corresponding id
+// returns snippet with corresponding id, scheduled ones included so their
+// author can see them
 func (m *SnippetModel) Get(id int) (Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted IS NULL AND id = ?`
 
 	// sql.Row object contains results from query execution
 	row := m.DB.QueryRow(stmt, id)
 
 	var s Snippet;
+	var expires sql.NullTime
 
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
 	if err != nil {
 		// row.Scan returns sql.ErrNoRows if query returns no rows
 		if errors.Is(err, sql.ErrNoRows) {
@@ -63,15 +119,16 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 			return Snippet{}, err
 		}
 	}
-
+	s.Expires = expires.Time
 
 	return s, nil;
 }
 
-// returns 10 most recently created snippets
+// returns 10 most recently published snippets, leaving out hidden, held and
+// scheduled ones
 func (m *SnippetModel) Latest() ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND published <= UTC_TIMESTAMP() AND deleted IS NULL AND hidden = FALSE AND held = FALSE ORDER BY published DESC, id DESC LIMIT 10`
 
 	rows, err := m.DB.Query(stmt)
 	if err != nil {
@@ -86,11 +143,13 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 
 	for rows.Next() {
 		var s Snippet
+		var expires sql.NullTime
 
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
 		if err != nil {
 			return nil, err
 		}
+		s.Expires = expires.Time
 
 		snippets = append(snippets, s)
 	}
@@ -101,4 +160,480 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	}
 
 	return snippets, nil
-}
\ No newline at end of file
+}
+
+// returns a page of a user's published snippets, most recent first
+func (m *SnippetModel) ByUser(userID, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND published <= UTC_TIMESTAMP() AND deleted IS NULL AND hidden = FALSE AND held = FALSE AND user_id = ? ORDER BY published DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		var expires sql.NullTime
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
+		if err != nil {
+			return nil, err
+		}
+		s.Expires = expires.Time
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// returns a page of all snippets (including expired, hidden and held ones, but
+// not trashed ones) whose title or content contains search, most recent first
+func (m *SnippetModel) List(search string, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE (title LIKE ? OR content LIKE ?) AND deleted IS NULL ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+
+	rows, err := m.DB.Query(stmt, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		var expires sql.NullTime
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
+		if err != nil {
+			return nil, err
+		}
+		s.Expires = expires.Time
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// hides or unhides a snippet, returns ErrNoRecord if it doesn't exist
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	stmt := `UPDATE snippets SET hidden = ? WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, hidden, id)
+	if err != nil {
+		return err
+	}
+
+	// MySQL only counts changed rows, so check the snippet exists if nothing changed
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		err = m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM snippets WHERE id = ?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// holds a snippet back from other users or releases it, returns ErrNoRecord
+// if it doesn't exist
+func (m *SnippetModel) SetHeld(id int, held bool) error {
+	stmt := `UPDATE snippets SET held = ? WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, held, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		err = m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM snippets WHERE id = ?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// changes when a snippet expires, a zero expires meaning never. Returns
+// ErrNoRecord if it doesn't exist, has already expired or is in the trash.
+func (m *SnippetModel) SetExpires(id int, expires time.Time) error {
+	stmt := `UPDATE snippets SET expires = ? WHERE id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted IS NULL`
+
+	result, err := m.DB.Exec(stmt, sql.NullTime{Time: expires.UTC(), Valid: !expires.IsZero()}, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		err = m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM snippets WHERE id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted IS NULL)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// returns a page of a user's snippets that haven't been published yet,
+// soonest first
+func (m *SnippetModel) Scheduled(userID, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND published > UTC_TIMESTAMP() AND deleted IS NULL AND user_id = ? ORDER BY published, id LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		var expires sql.NullTime
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
+		if err != nil {
+			return nil, err
+		}
+		s.Expires = expires.Time
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// reschedules one of userID's scheduled snippets, a zero published meaning
+// now. Returns ErrNoRecord if it isn't theirs, has already been published or
+// is in the trash.
+func (m *SnippetModel) SetPublished(id, userID int, published time.Time) error {
+	stmt := `UPDATE snippets SET published = COALESCE(?, UTC_TIMESTAMP())
+	WHERE id = ? AND user_id = ? AND published > UTC_TIMESTAMP() AND deleted IS NULL`
+
+	result, err := m.DB.Exec(stmt, sql.NullTime{Time: published.UTC(), Valid: !published.IsZero()}, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		err = m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM snippets WHERE id = ? AND user_id = ? AND published > UTC_TIMESTAMP() AND deleted IS NULL)`, id, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// returns the scheduled snippets that were published after after and no
+// later than until, oldest first, leaving out hidden and held ones. Snippets
+// published when they were created aren't included.
+func (m *SnippetModel) PublishedBetween(after, until time.Time) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held FROM snippets
+	WHERE published > ? AND published <= ? AND published > created AND (expires IS NULL OR expires > UTC_TIMESTAMP())
+	AND deleted IS NULL AND hidden = FALSE AND held = FALSE ORDER BY published, id`
+
+	rows, err := m.DB.Query(stmt, after.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		var expires sql.NullTime
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held)
+		if err != nil {
+			return nil, err
+		}
+		s.Expires = expires.Time
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// permanently deletes a snippet, along with its reports and spam reviews,
+// returns ErrNoRecord if it doesn't exist
+func (m *SnippetModel) Delete(id int) error {
+	n, err := m.deleteWhere(context.Background(), `id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// permanently deletes up to limit snippets that have expired, along with
+// their reports and spam reviews, returns how many snippets were deleted
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	return m.deleteWhere(ctx, `expires <= UTC_TIMESTAMP() ORDER BY id LIMIT ?`, limit)
+}
+
+// moves a snippet to the trash, returns ErrNoRecord if it doesn't exist or
+// is already there
+func (m *SnippetModel) Trash(id int) error {
+	stmt := `UPDATE snippets SET deleted = UTC_TIMESTAMP() WHERE id = ? AND deleted IS NULL`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// returns a page of a user's trash, most recently deleted first, expired
+// snippets included since they're still there until purged
+func (m *SnippetModel) Trashed(userID, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, published, expires, hidden, held, deleted FROM snippets
+	WHERE user_id = ? AND deleted IS NOT NULL ORDER BY deleted DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		var expires sql.NullTime
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Published, &expires, &s.Hidden, &s.Held, &s.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		s.Expires = expires.Time
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// takes a snippet out of userID's trash, returns ErrNoRecord if it isn't in
+// their trash
+func (m *SnippetModel) Restore(id, userID int) error {
+	stmt := `UPDATE snippets SET deleted = NULL WHERE id = ? AND user_id = ? AND deleted IS NOT NULL`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// permanently deletes a snippet from userID's trash, along with its reports
+// and spam reviews, returns ErrNoRecord if it isn't in their trash
+func (m *SnippetModel) DeleteTrashed(id, userID int) error {
+	n, err := m.deleteWhere(context.Background(), `id = ? AND user_id = ? AND deleted IS NOT NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// permanently deletes up to limit snippets that were moved to the trash
+// before before, returns how many were deleted
+func (m *SnippetModel) PurgeTrash(ctx context.Context, before time.Time, limit int) (int, error) {
+	return m.deleteWhere(ctx, `deleted < ? ORDER BY id LIMIT ?`, before.UTC(), limit)
+}
+
+// permanently deletes the snippets matching where, along with their reports
+// and spam reviews, returns how many snippets were deleted
+func (m *SnippetModel) deleteWhere(ctx context.Context, where string, args ...any) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM snippets WHERE `+where+` FOR UPDATE`, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []any
+
+	for rows.Next() {
+		var id int
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	for _, stmt := range []string{
+		`DELETE FROM reports WHERE snippet_id IN (%s)`,
+		`DELETE FROM spam_reviews WHERE snippet_id IN (%s)`,
+		`DELETE FROM snippets WHERE id IN (%s)`,
+	} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(stmt, placeholders), ids...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// returns how many snippets were created on each of the last few days
+// (UTC, including today), oldest first, days without snippets are left out
+func (m *SnippetModel) CountsByDay(days int) ([]DailyCount, error) {
+	stmt := `SELECT DATE(created) AS day, COUNT(*) FROM snippets
+	WHERE created >= DATE_SUB(UTC_DATE(), INTERVAL ? DAY)
+	GROUP BY day ORDER BY day`
+
+	rows, err := m.DB.Query(stmt, days-1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []DailyCount
+
+	for rows.Next() {
+		var c DailyCount
+
+		err = rows.Scan(&c.Day, &c.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// returns the number and size of a user's snippets that haven't expired,
+// hidden, held and trashed ones included since they're still stored.
+// Trashed snippets only stop counting once they're deleted for good.
+func (m *SnippetModel) Usage(userID int) (SnippetUsage, error) {
+	stmt := `SELECT COUNT(*), COALESCE(SUM(LENGTH(title) + LENGTH(content)), 0) FROM snippets
+	WHERE user_id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP())`
+
+	var u SnippetUsage
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&u.Count, &u.Bytes)
+	if err != nil {
+		return SnippetUsage{}, err
+	}
+
+	return u, nil
+}
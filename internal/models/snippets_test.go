@@ -0,0 +1,311 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestSnippetModelUsage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	week := time.Now().AddDate(0, 0, 7)
+
+	_, err := m.Insert(1, "O snail", "Climb Mount Fuji", time.Time{}, week, false)
+	assert.NilError(t, err)
+	_, err = m.Insert(1, "Held", "0123456789", time.Time{}, time.Time{}, true)
+	assert.NilError(t, err)
+	trashed, err := m.Insert(1, "Trashed", "0123", time.Time{}, week, false)
+	assert.NilError(t, err)
+	assert.NilError(t, m.Trash(trashed))
+	_, err = m.Insert(2, "Someone else's", "0123456789", time.Time{}, week, false)
+	assert.NilError(t, err)
+
+	// already expired
+	_, err = db.Exec(`INSERT INTO snippets (user_id, title, content, created, published, expires) VALUES (1, 'Old', 'Old', UTC_TIMESTAMP(), UTC_TIMESTAMP(), UTC_TIMESTAMP())`)
+	assert.NilError(t, err)
+
+	usage, err := m.Usage(1)
+	assert.NilError(t, err)
+	assert.Equal(t, usage.Count, 3)
+	assert.Equal(t, usage.Bytes, int64(len("O snail")+len("Climb Mount Fuji")+len("Held")+len("0123456789")+len("Trashed")+len("0123")))
+
+	// deleting from the trash frees the space
+	assert.NilError(t, m.DeleteTrashed(trashed, 1))
+	usage, err = m.Usage(1)
+	assert.NilError(t, err)
+	assert.Equal(t, usage.Count, 2)
+
+	usage, err = m.Usage(3)
+	assert.NilError(t, err)
+	assert.Equal(t, usage, SnippetUsage{})
+}
+
+func TestSnippetModelExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	expires := time.Now().AddDate(0, 0, 7).Truncate(time.Second)
+
+	id, err := m.Insert(1, "O snail", "Climb Mount Fuji", time.Time{}, expires, false)
+	assert.NilError(t, err)
+
+	s, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Expires.Equal(expires), true)
+
+	// never expires
+	assert.NilError(t, m.SetExpires(id, time.Time{}))
+	s, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Expires.IsZero(), true)
+
+	// unchanged
+	assert.NilError(t, m.SetExpires(id, time.Time{}))
+
+	// expired snippets can't be brought back
+	assert.NilError(t, m.SetExpires(id, time.Now().Add(-time.Minute)))
+	assert.Equal(t, m.SetExpires(id, expires), ErrNoRecord)
+	_, err = m.Get(id)
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	reports := ReportModel{db}
+	spam := SpamModel{db}
+
+	past := time.Now().Add(-time.Minute)
+
+	var expired []int
+	for range 3 {
+		id, err := m.Insert(1, "Old", "Old", time.Time{}, past, false)
+		assert.NilError(t, err)
+		expired = append(expired, id)
+	}
+
+	kept, err := m.Insert(1, "O snail", "Climb Mount Fuji", time.Time{}, time.Time{}, false)
+	assert.NilError(t, err)
+
+	_, err = reports.Insert(expired[0], 2, ReportReasonSpam, "")
+	assert.NilError(t, err)
+	_, err = spam.Queue(expired[1], 0.97, "classifier score 0.97", false)
+	assert.NilError(t, err)
+	_, err = reports.Insert(kept, 2, ReportReasonSpam, "")
+	assert.NilError(t, err)
+
+	// in batches
+	n, err := m.DeleteExpired(ctx, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+
+	n, err = m.DeleteExpired(ctx, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.DeleteExpired(ctx, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	var snippets, reportCount, reviews int
+	err = db.QueryRow("SELECT (SELECT COUNT(*) FROM snippets), (SELECT COUNT(*) FROM reports), (SELECT COUNT(*) FROM spam_reviews)").Scan(&snippets, &reportCount, &reviews)
+	assert.NilError(t, err)
+	assert.Equal(t, snippets, 1)
+	assert.Equal(t, reportCount, 1)
+	assert.Equal(t, reviews, 0)
+}
+
+func TestSnippetModelDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	reports := ReportModel{db}
+	spam := SpamModel{db}
+
+	id, err := m.Insert(1, "Buy cheap watches", "Buy cheap watches...", time.Time{}, time.Time{}, false)
+	assert.NilError(t, err)
+
+	_, err = reports.Insert(id, 2, ReportReasonSpam, "")
+	assert.NilError(t, err)
+	_, err = spam.Queue(id, 0.97, "classifier score 0.97", false)
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.Delete(id))
+	assert.Equal(t, m.Delete(id), ErrNoRecord)
+
+	// nothing is left in the moderation queues
+	var reportCount, reviews int
+	err = db.QueryRow("SELECT (SELECT COUNT(*) FROM reports), (SELECT COUNT(*) FROM spam_reviews)").Scan(&reportCount, &reviews)
+	assert.NilError(t, err)
+	assert.Equal(t, reportCount, 0)
+	assert.Equal(t, reviews, 0)
+}
+
+func TestSnippetModelTrash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	id, err := m.Insert(1, "Deploy runbook", "1. Take a deep breath", time.Time{}, time.Time{}, false)
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.Trash(id))
+	assert.Equal(t, m.Trash(id), ErrNoRecord)
+
+	// left out everywhere but the trash
+	_, err = m.Get(id)
+	assert.Equal(t, err, ErrNoRecord)
+	latest, err := m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 0)
+	found, err := m.List("runbook", 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 0)
+
+	trashed, err := m.Trashed(1, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(trashed), 1)
+	assert.Equal(t, trashed[0].Deleted.IsZero(), false)
+
+	// only from the author's trash
+	assert.Equal(t, m.Restore(id, 2), ErrNoRecord)
+	assert.Equal(t, m.DeleteTrashed(id, 2), ErrNoRecord)
+
+	assert.NilError(t, m.Restore(id, 1))
+	_, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, m.Restore(id, 1), ErrNoRecord)
+
+	// permanently
+	assert.NilError(t, m.Trash(id))
+	assert.NilError(t, m.DeleteTrashed(id, 1))
+	trashed, err = m.Trashed(1, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(trashed), 0)
+
+	// purged after the retention window
+	id, err = m.Insert(1, "Old runbook", "...", time.Time{}, time.Time{}, false)
+	assert.NilError(t, err)
+	assert.NilError(t, m.Trash(id))
+
+	n, err := m.PurgeTrash(ctx, time.Now().Add(-time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	n, err = m.PurgeTrash(ctx, time.Now().Add(time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+}
+
+func TestSnippetModelScheduled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	published := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	id, err := m.Insert(1, "Release notes", "Version 2 is out", published, time.Time{}, false)
+	assert.NilError(t, err)
+
+	// its author can still get it
+	s, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Published.Equal(published), true)
+	assert.Equal(t, s.IsScheduled(), true)
+
+	// but it's left out of listings until it's published
+	latest, err := m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 0)
+	byUser, err := m.ByUser(1, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(byUser), 0)
+
+	scheduled, err := m.Scheduled(1, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(scheduled), 1)
+	scheduled, err = m.Scheduled(2, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(scheduled), 0)
+
+	// only by its author
+	assert.Equal(t, m.SetPublished(id, 2, published), ErrNoRecord)
+
+	later := published.Add(24 * time.Hour)
+	assert.NilError(t, m.SetPublished(id, 1, later))
+	// unchanged
+	assert.NilError(t, m.SetPublished(id, 1, later))
+	s, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Published.Equal(later), true)
+
+	// now
+	assert.NilError(t, m.SetPublished(id, 1, time.Time{}))
+	latest, err = m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 1)
+
+	// can't be unpublished
+	assert.Equal(t, m.SetPublished(id, 1, later), ErrNoRecord)
+}
+
+func TestSnippetModelPublishedBetween(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	now := time.Now().Truncate(time.Second)
+
+	_, err := m.Insert(1, "Straight away", "...", time.Time{}, time.Time{}, false)
+	assert.NilError(t, err)
+	scheduled, err := m.Insert(1, "Release notes", "Version 2 is out", now.Add(time.Hour), time.Time{}, false)
+	assert.NilError(t, err)
+	_, err = m.Insert(1, "Held", "...", now.Add(time.Hour), time.Time{}, true)
+	assert.NilError(t, err)
+
+	found, err := m.PublishedBetween(now.Add(-time.Minute), now.Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 0)
+
+	found, err = m.PublishedBetween(now.Add(59*time.Minute), now.Add(time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 1)
+	assert.Equal(t, found[0].ID, scheduled)
+
+	// after is exclusive
+	found, err = m.PublishedBetween(now.Add(time.Hour), now.Add(2*time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 0)
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// moderator decisions about a snippet in the spam queue
+const (
+	SpamDecisionSpam = "spam"
+	SpamDecisionHam = "ham"
+)
+
+// a snippet the spam filter flagged, waiting for a moderator
+type SpamReview struct {
+	ID int
+	SnippetID int
+	Score float64
+	Reasons string
+	// the snippet was held back from other users rather than just queued
+	Held bool
+	Created time.Time
+	// empty until a moderator decides
+	Decision string
+	ResolvedBy int
+	Resolved time.Time
+	// title and author of the snippet, for the queue
+	SnippetTitle string
+	SnippetUserID int
+}
+
+// interface for the spam classifier's token counts and the review queue,
+// the first three methods make it a spam.Store
+type SpamModelInterface interface {
+	Totals() (spam, ham int, err error)
+	TokenCounts(tokens []string) (spam, ham map[string]int, err error)
+	Train(tokens []string, isSpam bool) error
+	Queue(snippetID int, score float64, reasons string, held bool) (int, error)
+	GetReview(id int) (SpamReview, error)
+	Pending(limit, offset int) ([]SpamReview, error)
+	Resolve(id, moderatorID int, decision string) error
+}
+
+// implements SpamModelInterface
+type SpamModel struct {
+	DB *sql.DB
+}
+
+// returns how many spam and ham snippets the classifier has been trained on
+func (m *SpamModel) Totals() (int, int, error) {
+	var spam, ham int
+
+	stmt := `SELECT COALESCE(SUM(spam_count), 0), COALESCE(SUM(ham_count), 0) FROM spam_totals`
+
+	err := m.DB.QueryRow(stmt).Scan(&spam, &ham)
+	return spam, ham, err
+}
+
+// returns how many spam and ham snippets each token has been seen in
+func (m *SpamModel) TokenCounts(tokens []string) (map[string]int, map[string]int, error) {
+	spam, ham := map[string]int{}, map[string]int{}
+	if len(tokens) == 0 {
+		return spam, ham, nil
+	}
+
+	stmt := `SELECT token, spam_count, ham_count FROM spam_tokens
+	WHERE token IN (?` + strings.Repeat(", ?", len(tokens)-1) + `)`
+
+	args := make([]any, len(tokens))
+	for i, t := range tokens {
+		args[i] = t
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		var s, h int
+
+		err = rows.Scan(&token, &s, &h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		spam[token], ham[token] = s, h
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return spam, ham, nil
+}
+
+// records one snippet's tokens as spam or ham
+func (m *SpamModel) Train(tokens []string, isSpam bool) error {
+	column := "ham_count"
+	if isSpam {
+		column = "spam_count"
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the totals are a single row
+	stmt := `INSERT INTO spam_totals (id, ` + column + `) VALUES (1, 1)
+	ON DUPLICATE KEY UPDATE ` + column + ` = ` + column + ` + 1`
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return err
+	}
+
+	// in batches to keep statements a reasonable size
+	for len(tokens) > 0 {
+		batch := tokens[:min(len(tokens), 500)]
+		tokens = tokens[len(batch):]
+
+		stmt := `INSERT INTO spam_tokens (token, ` + column + `) VALUES (?, 1)` + strings.Repeat(", (?, 1)", len(batch)-1) + `
+		ON DUPLICATE KEY UPDATE ` + column + ` = ` + column + ` + 1`
+
+		args := make([]any, len(batch))
+		for i, t := range batch {
+			args[i] = t
+		}
+
+		_, err = tx.Exec(stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// adds a flagged snippet to the review queue, returns the new review's ID
+func (m *SpamModel) Queue(snippetID int, score float64, reasons string, held bool) (int, error) {
+	stmt := `INSERT INTO spam_reviews (snippet_id, score, reasons, held, created)
+	VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, score, reasons, held)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// returns review with corresponding id
+func (m *SpamModel) GetReview(id int) (SpamReview, error) {
+	stmt := `SELECT sr.id, sr.snippet_id, sr.score, sr.reasons, sr.held, sr.created,
+	COALESCE(sr.decision, ''), COALESCE(sr.resolved_by, 0), sr.resolved, COALESCE(s.title, ''), COALESCE(s.user_id, 0)
+	FROM spam_reviews sr LEFT JOIN snippets s ON s.id = sr.snippet_id WHERE sr.id = ?`
+
+	var sr SpamReview
+	var resolved sql.NullTime
+
+	err := m.DB.QueryRow(stmt, id).Scan(&sr.ID, &sr.SnippetID, &sr.Score, &sr.Reasons, &sr.Held, &sr.Created,
+		&sr.Decision, &sr.ResolvedBy, &resolved, &sr.SnippetTitle, &sr.SnippetUserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SpamReview{}, ErrNoRecord
+		} else {
+			return SpamReview{}, err
+		}
+	}
+	sr.Resolved = resolved.Time
+
+	return sr, nil
+}
+
+// returns a page of the reviews no one has decided on yet, oldest first
+func (m *SpamModel) Pending(limit, offset int) ([]SpamReview, error) {
+	stmt := `SELECT sr.id, sr.snippet_id, sr.score, sr.reasons, sr.held, sr.created,
+	COALESCE(s.title, ''), COALESCE(s.user_id, 0)
+	FROM spam_reviews sr LEFT JOIN snippets s ON s.id = sr.snippet_id
+	WHERE sr.decision IS NULL ORDER BY sr.id LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []SpamReview
+
+	for rows.Next() {
+		var sr SpamReview
+
+		err = rows.Scan(&sr.ID, &sr.SnippetID, &sr.Score, &sr.Reasons, &sr.Held, &sr.Created,
+			&sr.SnippetTitle, &sr.SnippetUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, sr)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// records a moderator's decision, returns ErrNoRecord if there's no such
+// pending review
+func (m *SpamModel) Resolve(id, moderatorID int, decision string) error {
+	stmt := `UPDATE spam_reviews SET decision = ?, resolved_by = ?, resolved = UTC_TIMESTAMP()
+	WHERE id = ? AND decision IS NULL`
+
+	result, err := m.DB.Exec(stmt, decision, moderatorID, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
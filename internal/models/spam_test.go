@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestSpamModelTrain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SpamModel{db}
+
+	assert.NilError(t, m.Train([]string{"cheap", "pills", "host:pills.example.com"}, true))
+	assert.NilError(t, m.Train([]string{"cheap", "func", "return"}, false))
+	assert.NilError(t, m.Train([]string{"func"}, false))
+
+	spam, ham, err := m.Totals()
+	assert.NilError(t, err)
+	assert.Equal(t, spam, 1)
+	assert.Equal(t, ham, 2)
+
+	spamCounts, hamCounts, err := m.TokenCounts([]string{"cheap", "func", "unseen"})
+	assert.NilError(t, err)
+	assert.Equal(t, spamCounts["cheap"], 1)
+	assert.Equal(t, hamCounts["cheap"], 1)
+	assert.Equal(t, spamCounts["func"], 0)
+	assert.Equal(t, hamCounts["func"], 2)
+	_, seen := spamCounts["unseen"]
+	assert.Equal(t, seen, false)
+}
+
+func TestSpamModelQueue(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SpamModel{db}
+
+	id, err := m.Queue(1, 0.97, "classifier score 0.97", true)
+	assert.NilError(t, err)
+
+	pending, err := m.Pending(10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 1)
+	assert.Equal(t, pending[0].Held, true)
+
+	assert.NilError(t, m.Resolve(id, 1, SpamDecisionHam))
+	// already decided
+	assert.Equal(t, m.Resolve(id, 1, SpamDecisionSpam), ErrNoRecord)
+
+	review, err := m.GetReview(id)
+	assert.NilError(t, err)
+	assert.Equal(t, review.Decision, SpamDecisionHam)
+	assert.Equal(t, review.ResolvedBy, 1)
+
+	pending, err = m.Pending(10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+}
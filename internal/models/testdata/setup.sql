@@ -1,26 +1,168 @@
 CREATE TABLE snippets (
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
   title VARCHAR(100) NOT NULL,
   content TEXT NOT NULL,
   created DATETIME NOT NULL,
-  expires DATETIME NOT NULL
+  published DATETIME NOT NULL,
+  expires DATETIME NULL,
+  hidden BOOLEAN NOT NULL DEFAULT FALSE,
+  held BOOLEAN NOT NULL DEFAULT FALSE,
+  deleted DATETIME NULL
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_published ON snippets(published);
+CREATE INDEX idx_snippets_deleted ON snippets(deleted);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
 
 CREATE TABLE users (
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
   name VARCHAR(255) NOT NULL,
+  handle VARCHAR(30) NOT NULL,
   email VARCHAR(255) NOT NULL,
+  email_verified BOOLEAN NOT NULL DEFAULT FALSE,
   hashed_password CHAR(60) NOT NULL,
+  totp_secret VARCHAR(64) NULL,
+  totp_last_step BIGINT NOT NULL DEFAULT 0,
+  external_id VARCHAR(255) NULL,
+  role VARCHAR(20) NOT NULL DEFAULT 'user',
+  disabled BOOLEAN NOT NULL DEFAULT FALSE,
   created DATETIME NOT NULL
 );
 
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+ALTER TABLE users ADD CONSTRAINT users_uc_handle UNIQUE (handle);
+ALTER TABLE users ADD CONSTRAINT users_uc_external_id UNIQUE (external_id);
 
-INSERT INTO users (name, email, hashed_password, created) VALUES (
+INSERT INTO users (name, handle, email, email_verified, hashed_password, created) VALUES (
   'Alice Jones',
+  'alice',
   'alice@example.com',
+  TRUE,
   '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
   '2022-01-01 09:18:24'
 );
+
+CREATE TABLE tokens (
+  hash BINARY(32) NOT NULL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  created DATETIME NOT NULL,
+  expiry DATETIME NOT NULL,
+  scope VARCHAR(30) NOT NULL
+);
+
+CREATE INDEX idx_tokens_user_id ON tokens(user_id);
+
+CREATE TABLE recovery_codes (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  hash BINARY(32) NOT NULL
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+CREATE TABLE login_events (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  email VARCHAR(255) NOT NULL,
+  ip VARCHAR(45) NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  created DATETIME(6) NOT NULL
+);
+
+CREATE INDEX idx_login_events_email_created ON login_events(email, created);
+CREATE INDEX idx_login_events_ip_created ON login_events(ip, created);
+
+CREATE TABLE login_lockouts (
+  email VARCHAR(255) NOT NULL PRIMARY KEY,
+  locked_until DATETIME NOT NULL
+);
+
+CREATE TABLE user_sessions (
+  id VARCHAR(32) NOT NULL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  ip VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(255) NOT NULL,
+  created DATETIME NOT NULL,
+  last_seen DATETIME NOT NULL
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+CREATE TABLE audit_log (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  actor_id INTEGER NOT NULL,
+  action VARCHAR(50) NOT NULL,
+  target_type VARCHAR(20) NOT NULL,
+  target_id INTEGER NOT NULL,
+  details VARCHAR(255) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE TABLE reports (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  snippet_id INTEGER NOT NULL,
+  reporter_id INTEGER NOT NULL,
+  reason VARCHAR(20) NOT NULL,
+  note VARCHAR(1000) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  created DATETIME NOT NULL,
+  resolved_by INTEGER NULL,
+  resolved DATETIME NULL
+);
+
+CREATE INDEX idx_reports_status ON reports(status);
+CREATE INDEX idx_reports_reporter_created ON reports(reporter_id, created);
+
+CREATE TABLE spam_tokens (
+  token VARCHAR(64) NOT NULL PRIMARY KEY,
+  spam_count INTEGER NOT NULL DEFAULT 0,
+  ham_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE spam_totals (
+  id TINYINT NOT NULL PRIMARY KEY,
+  spam_count INTEGER NOT NULL DEFAULT 0,
+  ham_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE spam_reviews (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  snippet_id INTEGER NOT NULL,
+  score DOUBLE NOT NULL,
+  reasons VARCHAR(255) NOT NULL,
+  held BOOLEAN NOT NULL,
+  created DATETIME NOT NULL,
+  decision VARCHAR(20) NULL,
+  resolved_by INTEGER NULL,
+  resolved DATETIME NULL
+);
+
+CREATE INDEX idx_spam_reviews_decision ON spam_reviews(decision);
+
+CREATE TABLE rate_limits (
+  bucket_key VARCHAR(255) NOT NULL PRIMARY KEY,
+  tokens DOUBLE NOT NULL,
+  updated DATETIME(6) NOT NULL,
+  full_at DATETIME(6) NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_full_at ON rate_limits(full_at);
+
+CREATE TABLE used_challenges (
+  id VARCHAR(32) NOT NULL PRIMARY KEY,
+  expires DATETIME NOT NULL
+);
+
+CREATE INDEX idx_used_challenges_expires ON used_challenges(expires);
+
+CREATE TABLE drafts (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  title VARCHAR(255) NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  updated DATETIME NOT NULL
+);
+
+CREATE INDEX idx_drafts_user_id ON drafts(user_id);
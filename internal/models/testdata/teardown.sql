@@ -1,3 +1,29 @@
+DROP TABLE drafts;
+
+DROP TABLE used_challenges;
+
+DROP TABLE rate_limits;
+
+DROP TABLE spam_reviews;
+
+DROP TABLE spam_totals;
+
+DROP TABLE spam_tokens;
+
+DROP TABLE reports;
+
+DROP TABLE audit_log;
+
+DROP TABLE user_sessions;
+
+DROP TABLE login_lockouts;
+
+DROP TABLE login_events;
+
+DROP TABLE recovery_codes;
+
+DROP TABLE tokens;
+
 DROP TABLE users;
 
 DROP TABLE snippets;
\ No newline at end of file
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// token scopes, a token is only ever valid for the scope it was created with
+const (
+	ScopePasswordReset = "password-reset"
+	ScopeEmailVerification = "email-verification"
+	ScopeAccountUnlock = "account-unlock"
+	ScopeLoginLink = "login-link"
+)
+
+type Token struct {
+	Plaintext string
+	Hash []byte
+	UserID int
+	Expiry time.Time
+	Scope string
+}
+
+// interface for single-use, time-limited tokens
+type TokenModelInterface interface {
+	New(userID int, ttl time.Duration, scope string) (Token, error)
+	Check(plaintext, scope string) (int, error)
+	Consume(plaintext, scope string) (int, error)
+	DeleteAllForUser(scope string, userID int) error
+	LastCreated(scope string, userID int) (time.Time, error)
+}
+
+// implements TokenModelInterface, only a SHA-256 hash of each token is stored
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// generates a random token and stores its hash in the 'tokens' table
+func (m *TokenModel) New(userID int, ttl time.Duration, scope string) (Token, error) {
+	token := Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl).UTC(),
+		Scope: scope,
+	}
+
+	// 32 random bytes gives 256 bits of entropy
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return Token{}, err
+	}
+
+	token.Plaintext = base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	stmt := `INSERT INTO tokens (hash, user_id, created, expiry, scope)
+	VALUES (?, ?, UTC_TIMESTAMP(), ?, ?)`
+
+	_, err = m.DB.Exec(stmt, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return Token{}, err
+	}
+
+	return token, nil
+}
+
+// returns the user ID for a valid, unexpired token without using it up
+func (m *TokenModel) Check(plaintext, scope string) (int, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	stmt := `SELECT user_id FROM tokens
+	WHERE hash = ? AND scope = ? AND expiry > UTC_TIMESTAMP()`
+
+	var userID int
+
+	err := m.DB.QueryRow(stmt, hash[:], scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// returns the user ID for a valid, unexpired token and deletes it
+// so it can't be used again
+func (m *TokenModel) Consume(plaintext, scope string) (int, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the row so two concurrent requests can't both use the token
+	stmt := `SELECT user_id FROM tokens
+	WHERE hash = ? AND scope = ? AND expiry > UTC_TIMESTAMP() FOR UPDATE`
+
+	var userID int
+
+	err = tx.QueryRow(stmt, hash[:], scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM tokens WHERE hash = ?`, hash[:])
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// deletes every token in a scope for a user
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	stmt := `DELETE FROM tokens WHERE scope = ? AND user_id = ?`
+
+	_, err := m.DB.Exec(stmt, scope, userID)
+	return err
+}
+
+// returns when the newest token in a scope was created for a user, or the
+// zero time if there isn't one, so callers can throttle how often they're sent
+func (m *TokenModel) LastCreated(scope string, userID int) (time.Time, error) {
+	stmt := `SELECT MAX(created) FROM tokens WHERE scope = ? AND user_id = ?`
+
+	var created sql.NullTime
+
+	err := m.DB.QueryRow(stmt, scope, userID).Scan(&created)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return created.Time, nil
+}
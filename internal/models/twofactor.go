@@ -0,0 +1,143 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+)
+
+// interface for storing TOTP secrets and one-time recovery codes
+type TwoFactorModelInterface interface {
+	Enable(userID int, secret string, recoveryCodes []string) error
+	Disable(userID int) error
+	Secret(userID int) (string, error)
+	UseStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, code string) (bool, error)
+	RecoveryCodesRemaining(userID int) (int, error)
+}
+
+// implements TwoFactorModelInterface
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// stores a confirmed TOTP secret for a user and replaces their recovery codes,
+// only hashes of the recovery codes are stored
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE USERS SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`
+
+	_, err = tx.Exec(stmt, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		hash := sha256.Sum256([]byte(code))
+
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, hash[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// removes a user's TOTP secret and recovery codes
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE USERS SET totp_secret = NULL WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// returns a user's TOTP secret, or ErrNoRecord if two-factor isn't enabled
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	stmt := `SELECT totp_secret FROM USERS WHERE id = ?`
+
+	var secret sql.NullString
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		} else {
+			return "", err
+		}
+	}
+
+	if !secret.Valid {
+		return "", ErrNoRecord
+	}
+
+	return secret.String, nil
+}
+
+// records that a TOTP time step has been used, returns false if it (or a
+// later one) was used before so that a code can't be replayed
+func (m *TwoFactorModel) UseStep(userID int, step int64) (bool, error) {
+	stmt := `UPDATE USERS SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// uses up a recovery code, returns false if it doesn't exist
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(code))
+
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+
+	result, err := m.DB.Exec(stmt, userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// returns how many unused recovery codes a user has left
+func (m *TwoFactorModel) RecoveryCodesRemaining(userID int) (int, error) {
+	var count int
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"errors"
 	"strings"
@@ -10,63 +11,109 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// user roles, each role can do everything the ones before it can
+const (
+	RoleUser = "user"
+	RoleModerator = "moderator"
+	RoleAdmin = "admin"
+)
+
+// all roles, lowest first
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
 type User struct {
 	ID int
 	Name string
+	Handle string
 	Email string
+	EmailVerified bool
+	// subject ID from the SSO provider, empty if the user isn't linked
+	ExternalID string
+	Role string
+	// disabled users can't log in
+	Disabled bool
 	HashedPassword []byte
 	Created time.Time
 }
 
+// reports whether the user has the given role or a higher one
+func (u User) HasRole(role string) bool {
+	return roleRank(u.Role) >= roleRank(role)
+}
+
+// returns the position of role in Roles, or -1 for unknown roles
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+
+	return -1
+}
+
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, handle, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
+	Get(id int) (User, error)
+	GetByHandle(handle string) (User, error)
+	UpdateName(id int, name string) error
+	UpdateEmail(id int, email string) error
+	UpdatePassword(id int, currentPassword, newPassword string) error
+	GetByEmail(email string) (User, error)
+	SetPassword(id int, password string) error
+	SetEmailVerified(id int) error
+	InsertExternal(name, handle, email, externalID string) (int, error)
+	GetByExternalID(externalID string) (User, error)
+	SetExternalID(id int, externalID string) error
+	SetRole(id int, role string) error
+	List(search string, limit, offset int) ([]User, error)
+	SetDisabled(id int, disabled bool) error
 }
 
 type UserModel struct {
 	DB *sql.DB
 }
 
-// inserts user to 'users' table
-func (m *UserModel) Insert(name, email, password string) error {
+// inserts user to 'users' table, returns the new user's ID
+func (m *UserModel) Insert(name, handle, email, password string) (int, error) {
 	// hash password using 10 salt rounds (2^10 iterations)
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	stmt := `INSERT into USERS (name, email, hashed_password, created)
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	stmt := `INSERT into USERS (name, handle, email, hashed_password, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
 
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	result, err := m.DB.Exec(stmt, name, handle, email, string(hashedPassword))
 	if err != nil {
-		var mySQLError *mysql.MySQLError
-		// check whether error has type *mysql.MySQLError and matches 1062(ER_DUP_ENTRY)
-		// relating to our unique email constraint on the 'users' table
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
-		}
+		// unique email or handle already taken
+		return 0, duplicateUserError(err)
+	}
 
-		return err
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return int(id), nil
 }
 
 // verifies whether a user exists with given email and password
-// returns relevant user ID if exists
+// returns relevant user ID if exists, or ErrAccountDisabled if the password
+// is right but the user has been disabled
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
+	var disabled bool
 
-	stmt := `SELECT id, hashed_password FROM USERS WHERE email = ?`
+	stmt := `SELECT id, hashed_password, disabled FROM USERS WHERE email = ?`
 
 	row := m.DB.QueryRow(stmt, email)
 
-	err := row.Scan(&id, &hashedPassword)
+	err := row.Scan(&id, &hashedPassword, &disabled)
 	if err != nil {
 		// email doesn't exist in db
 		if errors.Is(err, sql.ErrNoRows) {
@@ -86,6 +133,10 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+
 	return id, nil
 }
 
@@ -97,4 +148,307 @@ func (m *UserModel) Exists(id int) (bool, error) {
 
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
-}
\ No newline at end of file
+}
+
+// returns user with corresponding id
+func (m *UserModel) Get(id int) (User, error) {
+	stmt := `SELECT id, name, handle, email, email_verified, COALESCE(external_id, ''), role, disabled, created FROM USERS WHERE id = ?`
+
+	var u User
+
+	err := m.DB.QueryRow(stmt, id).Scan(&u.ID, &u.Name, &u.Handle, &u.Email, &u.EmailVerified, &u.ExternalID, &u.Role, &u.Disabled, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return u, nil
+}
+
+// returns user with corresponding handle
+func (m *UserModel) GetByHandle(handle string) (User, error) {
+	stmt := `SELECT id, name, handle, email, email_verified, COALESCE(external_id, ''), role, disabled, created FROM USERS WHERE handle = ?`
+
+	var u User
+
+	err := m.DB.QueryRow(stmt, handle).Scan(&u.ID, &u.Name, &u.Handle, &u.Email, &u.EmailVerified, &u.ExternalID, &u.Role, &u.Disabled, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return u, nil
+}
+
+// changes a user's display name
+func (m *UserModel) UpdateName(id int, name string) error {
+	stmt := `UPDATE USERS SET name = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, name, id)
+	return err
+}
+
+// changes a user's email address, returns ErrDuplicateEmail if already in use
+// the new address has to be verified again
+func (m *UserModel) UpdateEmail(id int, email string) error {
+	stmt := `UPDATE USERS SET email = ?, email_verified = FALSE WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, email, id)
+	if err != nil {
+		return duplicateUserError(err)
+	}
+
+	return nil
+}
+
+// replaces a user's password after checking their current one,
+// returns ErrInvalidCredentials if the current password doesn't match
+func (m *UserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
+	var currentHashedPassword []byte
+
+	stmt := `SELECT hashed_password FROM USERS WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&currentHashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		} else {
+			return err
+		}
+	}
+
+	err = bcrypt.CompareHashAndPassword(currentHashedPassword, []byte(currentPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		} else {
+			return err
+		}
+	}
+
+	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE USERS SET hashed_password = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, string(newHashedPassword), id)
+	return err
+}
+
+// returns user with corresponding email address
+func (m *UserModel) GetByEmail(email string) (User, error) {
+	stmt := `SELECT id, name, handle, email, email_verified, COALESCE(external_id, ''), role, disabled, created FROM USERS WHERE email = ?`
+
+	var u User
+
+	err := m.DB.QueryRow(stmt, email).Scan(&u.ID, &u.Name, &u.Handle, &u.Email, &u.EmailVerified, &u.ExternalID, &u.Role, &u.Disabled, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return u, nil
+}
+
+// replaces a user's password without checking the current one,
+// callers must have verified the user some other way (i.e. a reset token)
+func (m *UserModel) SetPassword(id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE USERS SET hashed_password = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, string(hashedPassword), id)
+	return err
+}
+
+// marks a user's email address as verified
+func (m *UserModel) SetEmailVerified(id int) error {
+	stmt := `UPDATE USERS SET email_verified = TRUE WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// inserts a user who signs in through the SSO provider, returns the new user's ID
+// their email address was verified by the provider, and they get a random
+// password nobody knows so they can't log in with one
+func (m *UserModel) InsertExternal(name, handle, email, externalID string) (int, error) {
+	password := make([]byte, 32)
+	_, err := rand.Read(password)
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword(password, 10)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT into USERS (name, handle, email, email_verified, external_id, hashed_password, created)
+	VALUES(?, ?, ?, TRUE, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, name, handle, email, externalID, string(hashedPassword))
+	if err != nil {
+		return 0, duplicateUserError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// returns user linked to the given SSO subject ID
+func (m *UserModel) GetByExternalID(externalID string) (User, error) {
+	stmt := `SELECT id, name, handle, email, email_verified, COALESCE(external_id, ''), role, disabled, created FROM USERS WHERE external_id = ?`
+
+	var u User
+
+	err := m.DB.QueryRow(stmt, externalID).Scan(&u.ID, &u.Name, &u.Handle, &u.Email, &u.EmailVerified, &u.ExternalID, &u.Role, &u.Disabled, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return u, nil
+}
+
+// links an existing user to an SSO subject ID
+func (m *UserModel) SetExternalID(id int, externalID string) error {
+	stmt := `UPDATE USERS SET external_id = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, externalID, id)
+	if err != nil {
+		return duplicateUserError(err)
+	}
+
+	return nil
+}
+
+// checks whether error has type *mysql.MySQLError and matches 1062(ER_DUP_ENTRY)
+// relating to one of the unique constraints on the 'users' table
+func duplicateUserError(err error) error {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) && mySQLError.Number == 1062 {
+		switch {
+		case strings.Contains(mySQLError.Message, "users_uc_email"):
+			return ErrDuplicateEmail
+		case strings.Contains(mySQLError.Message, "users_uc_handle"):
+			return ErrDuplicateHandle
+		case strings.Contains(mySQLError.Message, "users_uc_external_id"):
+			return ErrDuplicateExternalID
+		}
+	}
+
+	return err
+}
+
+// changes a user's role, returns ErrNoRecord if the user doesn't exist
+func (m *UserModel) SetRole(id int, role string) error {
+	stmt := `UPDATE USERS SET role = ? WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, role, id)
+	if err != nil {
+		return err
+	}
+
+	// MySQL only counts changed rows, so check the user exists if nothing changed
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		exists, err := m.Exists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// escapes the wildcard characters in user input for a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// returns a page of users whose name, handle or email contains search,
+// most recent first
+func (m *UserModel) List(search string, limit, offset int) ([]User, error) {
+	stmt := `SELECT id, name, handle, email, email_verified, COALESCE(external_id, ''), role, disabled, created FROM USERS
+	WHERE name LIKE ? OR handle LIKE ? OR email LIKE ? ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+
+	rows, err := m.DB.Query(stmt, pattern, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		var u User
+
+		err = rows.Scan(&u.ID, &u.Name, &u.Handle, &u.Email, &u.EmailVerified, &u.ExternalID, &u.Role, &u.Disabled, &u.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// disables or re-enables a user, returns ErrNoRecord if the user doesn't exist
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	stmt := `UPDATE USERS SET disabled = ? WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, disabled, id)
+	if err != nil {
+		return err
+	}
+
+	// MySQL only counts changed rows, so check the user exists if nothing changed
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		exists, err := m.Exists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
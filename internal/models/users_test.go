@@ -46,4 +46,46 @@ func TestUserModelExists(t *testing.T) {
 			assert.NilError(t, err)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestUserHasRole(t *testing.T) {
+	tests := []struct {
+		name string
+		userRole string
+		role string
+		want bool
+	}{
+		{
+			name: "Same role",
+			userRole: RoleModerator,
+			role: RoleModerator,
+			want: true,
+		},
+		{
+			name: "Higher role",
+			userRole: RoleAdmin,
+			role: RoleModerator,
+			want: true,
+		},
+		{
+			name: "Lower role",
+			userRole: RoleUser,
+			role: RoleModerator,
+			want: false,
+		},
+		{
+			name: "Unknown role",
+			userRole: "",
+			role: RoleUser,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := User{Role: tt.userRole}
+
+			assert.Equal(t, u.HasRole(tt.role), tt.want)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+)
+
+// metadata about one logged in browser, separate from the scs session
+// data so that it can be listed and revoked by the user
+type UserSession struct {
+	ID string
+	UserID int
+	IP string
+	UserAgent string
+	Created time.Time
+	LastSeen time.Time
+}
+
+type UserSessionModelInterface interface {
+	Insert(userID int, ip, userAgent string) (string, error)
+	Touch(id string, userID int) (bool, error)
+	ForUser(userID int) ([]UserSession, error)
+	Delete(id string, userID int) error
+	DeleteAllForUser(userID int, exceptID string) error
+}
+
+// implements UserSessionModelInterface
+type UserSessionModel struct {
+	DB *sql.DB
+}
+
+// records a new login, returns the random ID for the session
+func (m *UserSessionModel) Insert(userID int, ip, userAgent string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	// user agents can be arbitrarily long
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	stmt := `INSERT INTO user_sessions (id, user_id, ip, user_agent, created, last_seen)
+	VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	_, err = m.DB.Exec(stmt, id, userID, ip, userAgent)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// returns whether a session still exists (i.e. hasn't been revoked),
+// updating its last seen time at most once a minute
+func (m *UserSessionModel) Touch(id string, userID int) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM user_sessions WHERE id = ? AND user_id = ?)`
+
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&exists)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	stmt = `UPDATE user_sessions SET last_seen = UTC_TIMESTAMP()
+	WHERE id = ? AND last_seen < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE)`
+
+	_, err = m.DB.Exec(stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// returns a user's sessions, most recently used first
+func (m *UserSessionModel) ForUser(userID int) ([]UserSession, error) {
+	stmt := `SELECT id, user_id, ip, user_agent, created, last_seen FROM user_sessions
+	WHERE user_id = ? ORDER BY last_seen DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+
+	for rows.Next() {
+		var s UserSession
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// revokes one of a user's sessions
+func (m *UserSessionModel) Delete(id string, userID int) error {
+	stmt := `DELETE FROM user_sessions WHERE id = ? AND user_id = ?`
+
+	_, err := m.DB.Exec(stmt, id, userID)
+	return err
+}
+
+// revokes all of a user's sessions apart from exceptID (which may be empty)
+func (m *UserSessionModel) DeleteAllForUser(userID int, exceptID string) error {
+	stmt := `DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`
+
+	_, err := m.DB.Exec(stmt, userID, exceptID)
+	return err
+}
@@ -0,0 +1,369 @@
+// Package oidc implements the relying party side of OpenID Connect sign in:
+// the authorization code flow with PKCE (RFC 7636) and verification of
+// RS256-signed ID tokens against the issuer's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	ErrNonceMismatch = errors.New("oidc: ID token nonce doesn't match")
+)
+
+// allowed difference between our clock and the issuer's
+const clockSkew = time.Minute
+
+// claims we use from a verified ID token
+type Claims struct {
+	Subject string `json:"sub"`
+	Email string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
+	Name string `json:"name"`
+	Nonce string `json:"nonce"`
+}
+
+// an OpenID provider, the endpoints are discovered from the issuer the
+// first time they're needed
+type Provider struct {
+	Issuer string
+	ClientID string
+	ClientSecret string
+	RedirectURL string
+	// defaults to http.DefaultClient
+	Client *http.Client
+
+	mu sync.Mutex
+	metadata *metadata
+	keys map[string]*rsa.PublicKey
+}
+
+// subset of the discovery document (OpenID Connect Discovery 1.0)
+type metadata struct {
+	Issuer string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// returns a random value suitable for the state, nonce or PKCE code verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// returns the S256 PKCE code challenge for verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// returns the URL to send the user to so they can sign in with the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// trades an authorization code for an ID token and returns its verified claims,
+// nonce must be the value given to AuthCodeURL
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	rs, err := p.client().Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("oidc: token endpoint returned %s", rs.Status)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(rs.Body).Decode(&token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	claims, err := p.verify(ctx, token.IDToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if claims.Nonce != nonce {
+		return Claims{}, ErrNonceMismatch
+	}
+
+	return claims, nil
+}
+
+// checks the signature, issuer, audience and lifetime of an ID token
+func (p *Provider) verify(ctx context.Context, rawToken string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	// only accept what we ask for, in particular never "none"
+	if header.Alg != "RS256" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var payload struct {
+		Claims
+		Issuer string `json:"iss"`
+		Audience audience `json:"aud"`
+		Expiry int64 `json:"exp"`
+		IssuedAt int64 `json:"iat"`
+	}
+	err = decodeSegment(parts[1], &payload)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	now := time.Now()
+	switch {
+	case payload.Issuer != p.Issuer:
+		return Claims{}, ErrInvalidToken
+	case !payload.Audience.contains(p.ClientID):
+		return Claims{}, ErrInvalidToken
+	case now.After(time.Unix(payload.Expiry, 0).Add(clockSkew)):
+		return Claims{}, ErrInvalidToken
+	case now.Add(clockSkew).Before(time.Unix(payload.IssuedAt, 0)):
+		return Claims{}, ErrInvalidToken
+	case payload.Subject == "":
+		return Claims{}, ErrInvalidToken
+	}
+
+	return payload.Claims, nil
+}
+
+// returns the provider's metadata, fetching it on first use
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &md)
+	if err != nil {
+		return nil, err
+	}
+
+	if md.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: issuer %q doesn't match discovery document %q", p.Issuer, md.Issuer)
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// returns the signing key with the given ID, the key set is fetched again
+// if the ID is unknown in case the provider has rotated its keys
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N string `json:"n"`
+			E string `json:"e"`
+		} `json:"keys"`
+	}
+	err = p.getJSON(ctx, md.JWKSURI, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	rs, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %s", url, rs.Status)
+	}
+
+	return json.NewDecoder(rs.Body).Decode(dst)
+}
+
+func (p *Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+
+	return http.DefaultClient
+}
+
+func decodeSegment(segment string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
+
+// the "aud" claim is either a single string or an array of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	if err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+	"snippetbox.derrc/internal/oidc"
+	"snippetbox.derrc/internal/oidc/oidctest"
+)
+
+// follows the authorization URL to the fake provider and returns the code
+// it redirects back with
+func authorize(t *testing.T, p *oidc.Provider, state, nonce, verifier string) string {
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	assert.NilError(t, err)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	rs, err := client.Get(authURL)
+	assert.NilError(t, err)
+	rs.Body.Close()
+
+	location, err := url.Parse(rs.Header.Get("Location"))
+	assert.NilError(t, err)
+	assert.Equal(t, location.Query().Get("state"), state)
+
+	return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	srv, err := oidctest.NewServer("snippetbox", "secret")
+	assert.NilError(t, err)
+	defer srv.Close()
+
+	srv.SetUser(oidctest.User{
+		Subject: "user-123",
+		Email: "dana@example.com",
+		EmailVerified: true,
+		Name: "Dana Scott",
+	})
+
+	newProvider := func(clientSecret string) *oidc.Provider {
+		return &oidc.Provider{
+			Issuer: srv.Issuer(),
+			ClientID: "snippetbox",
+			ClientSecret: clientSecret,
+			RedirectURL: "https://localhost:4000/user/login/sso/callback",
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		p := newProvider("secret")
+		code := authorize(t, p, "state", "nonce", "verifier")
+
+		claims, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+		assert.NilError(t, err)
+		assert.Equal(t, claims.Subject, "user-123")
+		assert.Equal(t, claims.Email, "dana@example.com")
+		assert.Equal(t, claims.EmailVerified, true)
+		assert.Equal(t, claims.Name, "Dana Scott")
+
+		// codes are single use
+		_, err = p.Exchange(context.Background(), code, "verifier", "nonce")
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Wrong code verifier", func(t *testing.T) {
+		p := newProvider("secret")
+		code := authorize(t, p, "state", "nonce", "verifier")
+
+		_, err := p.Exchange(context.Background(), code, "otherVerifier", "nonce")
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Wrong nonce", func(t *testing.T) {
+		p := newProvider("secret")
+		code := authorize(t, p, "state", "nonce", "verifier")
+
+		_, err := p.Exchange(context.Background(), code, "verifier", "otherNonce")
+		assert.Equal(t, errors.Is(err, oidc.ErrNonceMismatch), true)
+	})
+
+	t.Run("Wrong client secret", func(t *testing.T) {
+		p := newProvider("wrongSecret")
+		code := authorize(t, p, "state", "nonce", "verifier")
+
+		_, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// example from RFC 7636 appendix B
+	got := oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	assert.Equal(t, got, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+}
@@ -0,0 +1,252 @@
+// Package pow implements hashcash-style proof-of-work challenges for forms.
+// The server issues a signed challenge; the browser has to find a nonce
+// such that SHA-256(challenge + ":" + nonce) starts with a number of zero
+// bits before the form is accepted. That costs a person a moment but makes
+// scripted abuse expensive. Each challenge can only be used once, and the
+// number of bits required goes up with the number of challenges recently
+// issued.
+package pow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("pow: invalid challenge")
+	ErrExpired = errors.New("pow: challenge has expired")
+	ErrUsed = errors.New("pow: challenge has already been used")
+	ErrInsufficientWork = errors.New("pow: nonce doesn't solve the challenge")
+)
+
+// longest nonce accepted, more than enough for any counter
+const maxNonceLength = 32
+
+// what a form needs to embed
+type Challenge struct {
+	// signed and opaque to the browser, it hashes it as is
+	Token string
+	// leading zero bits the hash needs
+	Difficulty int
+}
+
+// remembers challenges that have been used until they expire
+type Store interface {
+	// marks id as used, returns false if it already was
+	Use(ctx context.Context, id string, expires time.Time) (bool, error)
+	// forgets challenges that expired before now
+	Cleanup(ctx context.Context, now time.Time) error
+}
+
+type Issuer struct {
+	// signs challenges, at least 32 random bytes
+	Key []byte
+	// how long a challenge can be solved and used for
+	TTL time.Duration
+	// bits required when traffic is normal
+	MinDifficulty int
+	MaxDifficulty int
+	// challenges issued per Window that count as normal traffic, each
+	// doubling beyond that adds a bit of difficulty
+	Baseline int
+	Window time.Duration
+	Used Store
+
+	mu sync.Mutex
+	windowStart time.Time
+	count int
+	prevCount int
+}
+
+// returns a new challenge for the form identified by scope, a challenge
+// can't be used for a different form
+func (i *Issuer) Issue(scope string, now time.Time) (Challenge, error) {
+	seed := make([]byte, 16)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	difficulty := i.record(now)
+
+	payload := strings.Join([]string{
+		"v1",
+		scope,
+		base64.RawURLEncoding.EncodeToString(seed),
+		strconv.Itoa(difficulty),
+		strconv.FormatInt(now.Add(i.TTL).Unix(), 10),
+	}, ".")
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(i.sign(payload))
+
+	return Challenge{Token: token, Difficulty: difficulty}, nil
+}
+
+// checks that nonce solves token, that token was issued by us for scope and
+// hasn't expired, and marks it used
+func (i *Issuer) Verify(ctx context.Context, scope, token, nonce string, now time.Time) error {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return ErrInvalid
+	}
+	if !hmac.Equal(mac, i.sign(string(payload))) {
+		return ErrInvalid
+	}
+
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 5 || fields[0] != "v1" || fields[1] != scope {
+		return ErrInvalid
+	}
+	difficulty, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return ErrInvalid
+	}
+	expiresUnix, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	expires := time.Unix(expiresUnix, 0)
+	if !now.Before(expires) {
+		return ErrExpired
+	}
+
+	if nonce == "" || len(nonce) > maxNonceLength || LeadingZeroBits(token, nonce) < difficulty {
+		return ErrInsufficientWork
+	}
+
+	// only now that we know it's genuine, so junk can't fill up the store
+	fresh, err := i.Used.Use(ctx, fields[2], expires)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrUsed
+	}
+
+	return nil
+}
+
+// counts a challenge being issued at now and returns the difficulty for it
+func (i *Issuer) record(now time.Time) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	switch elapsed := now.Sub(i.windowStart); {
+	case elapsed >= 2*i.Window:
+		i.windowStart, i.count, i.prevCount = now, 0, 0
+	case elapsed >= i.Window:
+		i.windowStart, i.count, i.prevCount = i.windowStart.Add(i.Window), 0, i.count
+	}
+	i.count++
+
+	// sliding window estimate: all of this window plus the part of the
+	// previous one that's still within Window of now
+	remaining := 1 - float64(now.Sub(i.windowStart))/float64(i.Window)
+	rate := float64(i.count) + float64(i.prevCount)*remaining
+
+	difficulty := i.MinDifficulty
+	if i.Baseline > 0 && rate > float64(i.Baseline) {
+		difficulty += int(math.Log2(rate/float64(i.Baseline))) + 1
+	}
+
+	return min(difficulty, i.MaxDifficulty)
+}
+
+func (i *Issuer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, i.Key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// returns the number of leading zero bits of SHA-256(token + ":" + nonce)
+func LeadingZeroBits(token, nonce string) int {
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+
+	return n
+}
+
+// finds a nonce for c the same way the browser does, for tests and clients
+// that aren't browsers
+func Solve(c Challenge) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if LeadingZeroBits(c.Token, nonce) >= c.Difficulty {
+			return nonce
+		}
+	}
+}
+
+// a Store for a single instance, keeping used challenges in memory
+type MemoryStore struct {
+	mu sync.Mutex
+	used map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{used: make(map[string]time.Time)}
+}
+
+func (m *MemoryStore) Use(ctx context.Context, id string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.used[id]; ok {
+		return false, nil
+	}
+
+	m.used[id] = expires
+	return true, nil
+}
+
+func (m *MemoryStore) Cleanup(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, expires := range m.used {
+		if expires.Before(now) {
+			delete(m.used, id)
+		}
+	}
+
+	return nil
+}
+
+// returns a random key suitable for Issuer.Key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("pow: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,129 @@
+package pow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func newTestIssuer() *Issuer {
+	return &Issuer{
+		Key: []byte("0123456789abcdef0123456789abcdef"),
+		TTL: 10 * time.Minute,
+		MinDifficulty: 8,
+		MaxDifficulty: 12,
+		Baseline: 10,
+		Window: time.Minute,
+		Used: NewMemoryStore(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	i := newTestIssuer()
+
+	c, err := i.Issue("signup", now)
+	assert.NilError(t, err)
+	assert.Equal(t, c.Difficulty, 8)
+
+	nonce := Solve(c)
+
+	// a nonce that doesn't do the work
+	var wrong string
+	for n := 0; ; n++ {
+		wrong = "x" + strings.Repeat("0", n)
+		if LeadingZeroBits(c.Token, wrong) < c.Difficulty {
+			break
+		}
+	}
+
+	tampered := []byte(c.Token)
+	tampered[5] ^= 1
+
+	other := &Issuer{Key: []byte("another key, another key, anothe"), TTL: time.Minute, Used: NewMemoryStore()}
+	foreign, err := other.Issue("signup", now)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name string
+		scope string
+		token string
+		nonce string
+		now time.Time
+		want error
+	}{
+		{name: "Wrong nonce", scope: "signup", token: c.Token, nonce: wrong, now: now, want: ErrInsufficientWork},
+		{name: "Empty nonce", scope: "signup", token: c.Token, nonce: "", now: now, want: ErrInsufficientWork},
+		{name: "Wrong scope", scope: "create", token: c.Token, nonce: nonce, now: now, want: ErrInvalid},
+		{name: "Tampered", scope: "signup", token: string(tampered), nonce: nonce, now: now, want: ErrInvalid},
+		{name: "Garbage", scope: "signup", token: "not a challenge", nonce: nonce, now: now, want: ErrInvalid},
+		{name: "Other key", scope: "signup", token: foreign.Token, nonce: Solve(foreign), now: now, want: ErrInvalid},
+		{name: "Expired", scope: "signup", token: c.Token, nonce: nonce, now: now.Add(11 * time.Minute), want: ErrExpired},
+		{name: "Valid", scope: "signup", token: c.Token, nonce: nonce, now: now, want: nil},
+		{name: "Replayed", scope: "signup", token: c.Token, nonce: nonce, now: now, want: ErrUsed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := i.Verify(ctx, tt.scope, tt.token, tt.nonce, tt.now)
+			assert.Equal(t, err, tt.want)
+		})
+	}
+}
+
+func TestDifficulty(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	i := newTestIssuer()
+
+	issue := func(n int, at time.Time) int {
+		var c Challenge
+		for range n {
+			var err error
+			c, err = i.Issue("signup", at)
+			assert.NilError(t, err)
+		}
+		return c.Difficulty
+	}
+
+	// up to the baseline
+	assert.Equal(t, issue(10, now), 8)
+	// a bit per doubling beyond it
+	assert.Equal(t, issue(1, now), 9)
+	assert.Equal(t, issue(10, now), 10)
+	assert.Equal(t, issue(20, now), 11)
+	// capped
+	assert.Equal(t, issue(100, now), 12)
+
+	// the previous window still counts for a while
+	assert.Equal(t, issue(1, now.Add(90*time.Second)), 11)
+
+	// and then it's forgotten
+	assert.Equal(t, issue(1, now.Add(5*time.Minute)), 8)
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	m := NewMemoryStore()
+
+	fresh, err := m.Use(ctx, "a", now.Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, fresh, true)
+
+	fresh, err = m.Use(ctx, "a", now.Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, fresh, false)
+
+	assert.NilError(t, m.Cleanup(ctx, now.Add(2*time.Minute)))
+
+	fresh, err = m.Use(ctx, "a", now.Add(3*time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, fresh, true)
+}
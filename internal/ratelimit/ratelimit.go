@@ -0,0 +1,195 @@
+// Package ratelimit implements token bucket rate limiting. Each key (a
+// client IP, user or API token) has a bucket holding up to Limit.Burst
+// tokens that refills steadily over Limit.Period; every request takes a
+// token and is refused when there are none left. Where the buckets are kept
+// is up to the Store, so limits can be shared between instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// allows Burst requests at once, refilling at Burst per Period, the zero
+// value means no limit
+type Limit struct {
+	Burst int
+	Period time.Duration
+}
+
+// parses a limit written as "burst/period", e.g. "10/1m", or "off"
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+
+	burst, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, want burst/period", s)
+	}
+
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", s)
+	}
+
+	p, err := time.ParseDuration(period)
+	if err != nil || p <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid period in %q", s)
+	}
+
+	return Limit{Burst: b, Period: p}, nil
+}
+
+// implements flag.Value
+func (l *Limit) String() string {
+	if l.Unlimited() {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// implements flag.Value
+func (l *Limit) Set(s string) error {
+	limit, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+
+	*l = limit
+	return nil
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Burst <= 0 || l.Period <= 0
+}
+
+// the value of the RateLimit-Policy header, e.g. "10;w=60"
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Burst, int(math.Ceil(l.Period.Seconds())))
+}
+
+// tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// the outcome of taking a token
+type Result struct {
+	Allowed bool
+	Limit int
+	// whole tokens left in the bucket
+	Remaining int
+	// time until the bucket is full again
+	Reset time.Duration
+	// time until the next token, when the request wasn't allowed
+	RetryAfter time.Duration
+}
+
+// the state of one token bucket, the zero value is a full bucket
+type Bucket struct {
+	Tokens float64
+	Updated time.Time
+}
+
+// refills the bucket for the time since it was last updated and takes a
+// token if there is one
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	burst := float64(limit.Burst)
+
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = min(burst, b.Tokens+elapsed*limit.rate())
+	}
+	b.Updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / limit.rate())
+	}
+
+	res.Remaining = int(b.Tokens)
+	res.Reset = seconds((burst - b.Tokens) / limit.rate())
+
+	return res
+}
+
+// returns when the bucket will be full again, after which it can be
+// forgotten
+func (b *Bucket) FullAt(limit Limit) time.Time {
+	return b.Updated.Add(seconds((float64(limit.Burst) - b.Tokens) / limit.rate()))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// keeps the buckets, implementations must be safe for concurrent use
+type Store interface {
+	// takes a token from the bucket for key
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// forgets buckets that have been full since before now
+	Cleanup(ctx context.Context, now time.Time) error
+}
+
+// a Store for a single instance, keeping buckets in memory
+type MemoryStore struct {
+	mu sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	Bucket
+	fullAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		m.buckets[key] = b
+	}
+
+	res := b.Take(limit, now)
+	b.fullAt = b.FullAt(limit)
+
+	return res, nil
+}
+
+func (m *MemoryStore) Cleanup(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if b.fullAt.Before(now) {
+			delete(m.buckets, key)
+		}
+	}
+
+	return nil
+}
+
+// returns how many buckets are being kept
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
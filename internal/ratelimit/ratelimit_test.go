@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in string
+		want Limit
+		wantErr bool
+	}{
+		{in: "10/1m", want: Limit{Burst: 10, Period: time.Minute}},
+		{in: "1/30s", want: Limit{Burst: 1, Period: 30 * time.Second}},
+		{in: "off", want: Limit{}},
+		{in: "10", wantErr: true},
+		{in: "0/1m", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "ten/1m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	limit := Limit{Burst: 3, Period: 3 * time.Second}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var b Bucket
+
+	// a new bucket starts full
+	for i := 2; i >= 0; i-- {
+		res := b.Take(limit, now)
+		assert.Equal(t, res.Allowed, true)
+		assert.Equal(t, res.Limit, 3)
+		assert.Equal(t, res.Remaining, i)
+	}
+
+	res := b.Take(limit, now)
+	assert.Equal(t, res.Allowed, false)
+	assert.Equal(t, res.Remaining, 0)
+	assert.Equal(t, res.RetryAfter, time.Second)
+	assert.Equal(t, res.Reset, 3*time.Second)
+
+	// one token a second
+	res = b.Take(limit, now.Add(time.Second))
+	assert.Equal(t, res.Allowed, true)
+	assert.Equal(t, res.Remaining, 0)
+
+	// never more than the burst
+	res = b.Take(limit, now.Add(time.Hour))
+	assert.Equal(t, res.Allowed, true)
+	assert.Equal(t, res.Remaining, 2)
+	assert.Equal(t, b.FullAt(limit), now.Add(time.Hour+time.Second))
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Burst: 1, Period: time.Minute}
+	now := time.Now()
+
+	m := NewMemoryStore()
+
+	res, err := m.Take(ctx, "a", limit, now)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+
+	res, err = m.Take(ctx, "a", limit, now)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, false)
+
+	// keys have their own buckets
+	res, err = m.Take(ctx, "b", limit, now.Add(30*time.Second))
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+
+	assert.NilError(t, m.Cleanup(ctx, now.Add(time.Minute+time.Second)))
+	assert.Equal(t, m.Len(), 1)
+
+	assert.NilError(t, m.Cleanup(ctx, now.Add(2*time.Minute)))
+	assert.Equal(t, m.Len(), 0)
+}
@@ -0,0 +1,320 @@
+// Package secrets looks for credentials in text before it is published:
+// cloud access keys, private key blocks, JWTs, passwords in URLs and other
+// high-entropy tokens. Rules are regular expressions, optionally with an
+// entropy threshold, and an allowlist suppresses known false positives such
+// as documented example keys.
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Rule struct {
+	ID string
+	Description string
+	Pattern *regexp.Regexp
+	// capture group holding the secret itself, 0 means the whole match
+	SecretGroup int
+	// minimum Shannon entropy (bits per character) of the secret for it to
+	// count, 0 disables the check
+	MinEntropy float64
+}
+
+// a likely secret found in scanned text
+type Finding struct {
+	RuleID string
+	Description string
+	// 1-based line number of the start of the match
+	Line int
+	// the secret with most of it masked, safe to show back to the user
+	Redacted string
+
+	secret string
+	offset int
+}
+
+type Scanner struct {
+	Rules []Rule
+	// secrets matching any of these are ignored
+	Allowlist []*regexp.Regexp
+}
+
+// returns a scanner with the default rules and allowlist
+func New() *Scanner {
+	return &Scanner{
+		Rules: DefaultRules(),
+		Allowlist: DefaultAllowlist(),
+	}
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			ID: "aws-access-key",
+			Description: "AWS access key ID",
+			Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA)[0-9A-Z]{16}\b`),
+		},
+		{
+			ID: "aws-secret-key",
+			Description: "AWS secret access key",
+			Pattern: regexp.MustCompile(`(?i)aws.{0,20}?secret.{0,20}?[:=]\s*["']?([A-Za-z0-9/+]{40})\b`),
+			SecretGroup: 1,
+			MinEntropy: 4,
+		},
+		{
+			ID: "gcp-api-key",
+			Description: "Google API key",
+			Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		},
+		{
+			ID: "github-token",
+			Description: "GitHub token",
+			Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[0-9A-Za-z]{36}|github_pat_[0-9A-Za-z_]{82})\b`),
+		},
+		{
+			ID: "slack-token",
+			Description: "Slack token",
+			Pattern: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`),
+		},
+		{
+			ID: "stripe-key",
+			Description: "Stripe secret key",
+			Pattern: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{16,}\b`),
+		},
+		{
+			ID: "private-key",
+			Description: "Private key block",
+			// the whole block, so its body isn't reported again as high-entropy strings
+			Pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----|\z)`),
+		},
+		{
+			ID: "jwt",
+			Description: "JSON Web Token",
+			Pattern: regexp.MustCompile(`\beyJ[0-9A-Za-z_-]{10,}\.eyJ[0-9A-Za-z_-]{10,}\.[0-9A-Za-z_-]{10,}`),
+		},
+		{
+			ID: "url-password",
+			Description: "Password in URL",
+			Pattern: regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^\s:/@]+:([^\s/@]+)@`),
+			SecretGroup: 1,
+		},
+		{
+			ID: "assigned-secret",
+			Description: "Secret assigned to a variable",
+			Pattern: regexp.MustCompile(`(?i)(?:secret|token|api[_-]?key|passw(?:or)?d|credentials?)["']?\s*[:=]+\s*["']?([A-Za-z0-9+/_.=-]{16,})`),
+			SecretGroup: 1,
+			MinEntropy: 3.5,
+		},
+		{
+			ID: "high-entropy-string",
+			Description: "High-entropy token",
+			Pattern: regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`),
+			MinEntropy: 4.5,
+		},
+	}
+}
+
+func DefaultAllowlist() []*regexp.Regexp {
+	return []*regexp.Regexp{
+		// AWS documentation keys end in EXAMPLE, and so do lots of others
+		regexp.MustCompile(`(?i)example`),
+		// placeholders and template variables
+		regexp.MustCompile(`^(?:\$\{?[A-Za-z_][A-Za-z0-9_]*\}?|\{\{.*\}\}|<[^>]*>|%[sv])$`),
+		regexp.MustCompile(`(?i)^(?:x+|\*+|\.+|password|passwd|pass|secret|changeme|hunter2)$`),
+	}
+}
+
+// returns every likely secret in text in the order they appear, text matched
+// by one rule isn't reported again by a later (more generic) one
+func (s *Scanner) Scan(text string) []Finding {
+	var findings []Finding
+	// byte ranges already reported
+	var covered [][2]int
+	overlaps := func(start, end int) bool {
+		for _, c := range covered {
+			if start < c[1] && c[0] < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, rule := range s.Rules {
+		for _, m := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			g := rule.SecretGroup
+			if 2*g+1 >= len(m) || m[2*g] < 0 {
+				continue
+			}
+			start, end := m[2*g], m[2*g+1]
+
+			if overlaps(start, end) {
+				continue
+			}
+
+			secret := text[start:end]
+			if rule.MinEntropy > 0 && Entropy(secret) < rule.MinEntropy {
+				continue
+			}
+			if s.allowed(secret) {
+				continue
+			}
+
+			covered = append(covered, [2]int{start, end})
+			findings = append(findings, Finding{
+				RuleID: rule.ID,
+				Description: rule.Description,
+				Line: strings.Count(text[:start], "\n") + 1,
+				Redacted: redact(secret),
+				secret: secret,
+				offset: start,
+			})
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return a.offset - b.offset
+	})
+
+	return findings
+}
+
+func (s *Scanner) allowed(secret string) bool {
+	for _, rx := range s.Allowlist {
+		if rx.MatchString(secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns an identifier for a set of findings that changes if any of the
+// secrets do, without revealing them
+func Fingerprint(findings []Finding) string {
+	if len(findings) == 0 {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, f := range findings {
+		fmt.Fprintf(h, "%s\x00%s\x00", f.RuleID, f.secret)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// returns the Shannon entropy of s in bits per character
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var e float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
+
+// keeps the first and last few characters of longer secrets, and shortens
+// the masked middle of very long ones
+func redact(secret string) string {
+	r := []rune(secret)
+	if len(r) <= 8 {
+		return strings.Repeat("*", len(r))
+	}
+
+	keep := min(4, len(r)/8)
+	return string(r[:keep]) + strings.Repeat("*", min(len(r)-2*keep, 24)) + string(r[len(r)-keep:])
+}
+
+// extra configuration, read from JSON like
+//
+//	{
+//	  "rules": [{"id": "internal-token", "description": "...", "pattern": "itk_[a-z0-9]{32}"}],
+//	  "allowlist": ["^test_"],
+//	  "disable": ["high-entropy-string"]
+//	}
+type config struct {
+	Rules []struct {
+		ID string `json:"id"`
+		Description string `json:"description"`
+		Pattern string `json:"pattern"`
+		SecretGroup int `json:"secretGroup"`
+		MinEntropy float64 `json:"minEntropy"`
+	} `json:"rules"`
+	Allowlist []string `json:"allowlist"`
+	// IDs of default rules to turn off
+	Disable []string `json:"disable"`
+}
+
+// returns a scanner with the default rules and allowlist adjusted by the
+// JSON configuration read from r
+func Load(r io.Reader) (*Scanner, error) {
+	var cfg config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+
+	s := New()
+	s.Rules = slices.DeleteFunc(s.Rules, func(rule Rule) bool {
+		return slices.Contains(cfg.Disable, rule.ID)
+	})
+
+	for _, c := range cfg.Rules {
+		if c.ID == "" {
+			return nil, fmt.Errorf("secrets: rule with pattern %q has no id", c.Pattern)
+		}
+
+		rx, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: rule %s: %w", c.ID, err)
+		}
+		if c.SecretGroup < 0 || c.SecretGroup > rx.NumSubexp() {
+			return nil, fmt.Errorf("secrets: rule %s: no capture group %d", c.ID, c.SecretGroup)
+		}
+
+		description := c.Description
+		if description == "" {
+			description = c.ID
+		}
+
+		s.Rules = append(s.Rules, Rule{
+			ID: c.ID,
+			Description: description,
+			Pattern: rx,
+			SecretGroup: c.SecretGroup,
+			MinEntropy: c.MinEntropy,
+		})
+	}
+
+	for _, pattern := range cfg.Allowlist {
+		rx, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: allowlist: %w", err)
+		}
+		s.Allowlist = append(s.Allowlist, rx)
+	}
+
+	return s, nil
+}
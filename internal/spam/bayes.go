@@ -0,0 +1,196 @@
+package spam
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// persists what the classifier has learnt
+type Store interface {
+	// returns how many spam and ham documents have been trained on
+	Totals() (spam, ham int, err error)
+	// returns how many spam and ham documents each token has been seen in,
+	// tokens that have never been seen are left out
+	TokenCounts(tokens []string) (spam, ham map[string]int, err error)
+	// records one document's (deduplicated) tokens as spam or ham
+	Train(tokens []string, isSpam bool) error
+}
+
+// how many tokens furthest from neutral are combined into a score
+const interestingTokens = 15
+
+// longest token kept, longer ones are cut
+const maxTokenLength = 64
+
+// a naive Bayesian classifier (Graham's "A Plan for Spam" with Robinson's
+// smoothing for rarely seen tokens)
+type Bayes struct {
+	Store Store
+	// spam and ham documents each needed before it gives an opinion
+	MinTraining int
+}
+
+func (b *Bayes) Check(c Content) (Result, error) {
+	nSpam, nHam, err := b.Store.Totals()
+	if err != nil {
+		return Result{}, err
+	}
+	if nSpam < b.MinTraining || nHam < b.MinTraining {
+		return Result{}, nil
+	}
+
+	tokens := Tokenize(c)
+	spamCounts, hamCounts, err := b.Store.TokenCounts(tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	probs := make([]float64, 0, len(tokens))
+	for _, t := range tokens {
+		s, h := spamCounts[t], hamCounts[t]
+		if s+h == 0 {
+			continue
+		}
+
+		spamFreq := float64(s) / float64(nSpam)
+		hamFreq := float64(h) / float64(nHam)
+		p := spamFreq / (spamFreq + hamFreq)
+
+		// pull tokens we've seen only a few times towards neutral
+		n := float64(s + h)
+		p = (0.5 + n*p) / (1 + n)
+
+		probs = append(probs, min(max(p, 0.01), 0.99))
+	}
+
+	slices.SortFunc(probs, func(a, b float64) int {
+		da, db := math.Abs(a-0.5), math.Abs(b-0.5)
+		switch {
+		case da > db:
+			return -1
+		case da < db:
+			return 1
+		}
+		return 0
+	})
+	probs = probs[:min(len(probs), interestingTokens)]
+
+	if len(probs) == 0 {
+		return Result{}, nil
+	}
+
+	// combine in log space so many tokens can't underflow
+	var eta float64
+	for _, p := range probs {
+		eta += math.Log(1-p) - math.Log(p)
+	}
+	score := 1 / (1 + math.Exp(eta))
+
+	return Result{Score: score, Reason: fmt.Sprintf("classifier score %.2f", score)}, nil
+}
+
+// learns from a moderator's decision about c
+func (b *Bayes) Train(c Content, isSpam bool) error {
+	return b.Store.Train(Tokenize(c), isSpam)
+}
+
+// returns the distinct tokens in c: lowercased words, title words marked as
+// such, and the hosts of any links
+func Tokenize(c Content) []string {
+	seen := map[string]bool{}
+	var tokens []string
+
+	add := func(t string) {
+		if len(t) > maxTokenLength {
+			// don't leave half a character at the end
+			t = strings.ToValidUTF8(t[:maxTokenLength], "")
+		}
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+
+	for _, link := range linkRX.FindAllString(c.Title+"\n"+c.Body, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err == nil && u.Hostname() != "" {
+			add("host:" + strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."))
+		}
+	}
+
+	for _, w := range wordRX.FindAllString(strings.ToLower(c.Title), -1) {
+		if len(w) >= 2 {
+			add("title:" + w)
+		}
+	}
+
+	for _, w := range wordRX.FindAllString(strings.ToLower(linkRX.ReplaceAllString(c.Body, " ")), -1) {
+		// skip very short words, and very long ones which are usually data
+		if len(w) >= 2 && len(w) <= 30 {
+			add(w)
+		}
+	}
+
+	return tokens
+}
+
+// a Store kept in memory, for tests and trying out the classifier
+type MemoryStore struct {
+	mu sync.Mutex
+	spam int
+	ham int
+	tokens map[string][2]int
+}
+
+func (m *MemoryStore) Totals() (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.spam, m.ham, nil
+}
+
+func (m *MemoryStore) TokenCounts(tokens []string) (map[string]int, map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	spam, ham := map[string]int{}, map[string]int{}
+	for _, t := range tokens {
+		if c, ok := m.tokens[t]; ok {
+			spam[t], ham[t] = c[0], c[1]
+		}
+	}
+
+	return spam, ham, nil
+}
+
+func (m *MemoryStore) Train(tokens []string, isSpam bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tokens == nil {
+		m.tokens = map[string][2]int{}
+	}
+
+	i := 1
+	if isSpam {
+		i = 0
+		m.spam++
+	} else {
+		m.ham++
+	}
+
+	for _, t := range tokens {
+		c := m.tokens[t]
+		c[i]++
+		m.tokens[t] = c
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package spam decides whether new content looks like spam. A Filter runs a
+// list of Checks over the content, each scoring it from 0 (fine) to 1
+// (certainly spam); the built-in checks are a Bayesian classifier trained
+// from moderator decisions and heuristics for link density and repetition.
+package spam
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// what gets classified
+type Content struct {
+	Title string
+	Body string
+}
+
+// one check's opinion of some content
+type Result struct {
+	// 0 for content that looks fine up to 1 for certain spam
+	Score float64
+	// why the score is high, for moderators
+	Reason string
+}
+
+// a stage of the filter, implementations must be safe for concurrent use
+type Check interface {
+	Check(c Content) (Result, error)
+}
+
+type Verdict struct {
+	Spam bool
+	// highest score of any check
+	Score float64
+	// reasons given by the checks that reached the threshold
+	Reasons []string
+}
+
+type Filter struct {
+	Checks []Check
+	// content that scores at least this in any check is suspected spam
+	Threshold float64
+}
+
+// runs every check over c
+func (f *Filter) Classify(c Content) (Verdict, error) {
+	var v Verdict
+
+	for _, check := range f.Checks {
+		res, err := check.Check(c)
+		if err != nil {
+			return Verdict{}, err
+		}
+
+		v.Score = max(v.Score, res.Score)
+		if res.Score >= f.Threshold {
+			v.Spam = true
+			if res.Reason != "" {
+				v.Reasons = append(v.Reasons, res.Reason)
+			}
+		}
+	}
+
+	return v, nil
+}
+
+var (
+	linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+	wordRX = regexp.MustCompile(`[\pL\pN][\pL\pN'_$-]*`)
+)
+
+// scores content by how much of it is links
+type LinkDensity struct {
+	// links allowed regardless of how long the content is
+	MaxLinks int
+	// links allowed per word beyond that
+	MaxRatio float64
+}
+
+func (l LinkDensity) Check(c Content) (Result, error) {
+	links := len(linkRX.FindAllString(c.Title+"\n"+c.Body, -1))
+	words := len(wordRX.FindAllString(linkRX.ReplaceAllString(c.Title+"\n"+c.Body, ""), -1))
+
+	if links <= l.MaxLinks {
+		return Result{}, nil
+	}
+
+	if words == 0 || float64(links)/float64(words) > l.MaxRatio {
+		return Result{Score: 1, Reason: fmt.Sprintf("%d links in %d words", links, words)}, nil
+	}
+
+	return Result{}, nil
+}
+
+// scores content by how much of it is the same line or word over and over
+type Repetition struct {
+	// content with fewer words than this isn't checked
+	MinWords int
+	// highest share of non-trivial lines that can be copies of another line
+	MaxDuplicateLines float64
+	// highest share of words that can be the same word
+	MaxWordShare float64
+}
+
+func (rep Repetition) Check(c Content) (Result, error) {
+	words := wordRX.FindAllString(strings.ToLower(c.Body), -1)
+	if len(words) < rep.MinWords {
+		return Result{}, nil
+	}
+
+	// short lines such as closing braces repeat in ordinary code
+	lines := map[string]int{}
+	total, duplicates := 0, 0
+	for _, line := range strings.Split(c.Body, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 10 {
+			continue
+		}
+		total++
+		if lines[line] > 0 {
+			duplicates++
+		}
+		lines[line]++
+	}
+	if total > 0 && float64(duplicates)/float64(total) > rep.MaxDuplicateLines {
+		return Result{Score: 1, Reason: fmt.Sprintf("%d of %d lines repeated", duplicates, total)}, nil
+	}
+
+	counts := map[string]int{}
+	top, topWord := 0, ""
+	for _, w := range words {
+		// short words like "a" or "if" are common in anything
+		if len(w) < 4 {
+			continue
+		}
+		counts[w]++
+		if counts[w] > top {
+			top, topWord = counts[w], w
+		}
+	}
+	if float64(top)/float64(len(words)) > rep.MaxWordShare {
+		return Result{Score: 1, Reason: fmt.Sprintf("%q is %d of %d words", topWord, top, len(words))}, nil
+	}
+
+	return Result{}, nil
+}
+
+// returns the default filter: the heuristics plus a Bayesian classifier
+// backed by store
+func NewFilter(store Store) *Filter {
+	return &Filter{
+		Checks: []Check{
+			LinkDensity{MaxLinks: 3, MaxRatio: 0.05},
+			Repetition{MinWords: 30, MaxDuplicateLines: 0.5, MaxWordShare: 0.3},
+			&Bayes{Store: store, MinTraining: 20},
+		},
+		Threshold: 0.9,
+	}
+}
@@ -0,0 +1,117 @@
+package spam
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+const goSnippet = `package main
+
+import "fmt"
+
+// prints the first few Fibonacci numbers
+func main() {
+	a, b := 0, 1
+	for i := 0; i < 10; i++ {
+		fmt.Println(a)
+		a, b = b, a+b
+	}
+}`
+
+func TestLinkDensity(t *testing.T) {
+	check := LinkDensity{MaxLinks: 3, MaxRatio: 0.05}
+
+	tests := []struct {
+		name string
+		body string
+		wantScore float64
+	}{
+		{"No links", goSnippet, 0},
+		{"A few links", "see https://go.dev/doc and https://pkg.go.dev/net/http for more", 0},
+		{"Mostly links", strings.Repeat("cheap pills https://pills.example.com/buy\n", 5), 1},
+		{"Many links in long text", strings.Repeat("lorem ipsum dolor sit amet consectetur ", 20) + strings.Repeat("https://go.dev ", 4), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := check.Check(Content{Body: tt.body})
+			assert.NilError(t, err)
+			assert.Equal(t, res.Score, tt.wantScore)
+		})
+	}
+}
+
+func TestRepetition(t *testing.T) {
+	check := Repetition{MinWords: 30, MaxDuplicateLines: 0.5, MaxWordShare: 0.3}
+
+	tests := []struct {
+		name string
+		body string
+		wantScore float64
+	}{
+		{"Code", goSnippet, 0},
+		{"Short", "buy buy buy buy", 0},
+		{"Repeated lines", strings.Repeat("best casino bonus online today\n", 10), 1},
+		{"Repeated word", strings.Repeat("casino ", 20) + strings.Repeat("one two three ", 10), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := check.Check(Content{Body: tt.body})
+			assert.NilError(t, err)
+			assert.Equal(t, res.Score, tt.wantScore)
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize(Content{
+		Title: "Cheap Pills",
+		Body: "Buy cheap pills at www.Pills.example.com or https://pills.example.com/buy a b",
+	})
+
+	assert.Equal(t, strings.Join(tokens, " "), "host:pills.example.com title:cheap title:pills buy cheap pills at or")
+}
+
+func TestBayes(t *testing.T) {
+	b := &Bayes{Store: &MemoryStore{}, MinTraining: 5}
+
+	spam := Content{Title: "Cheap pills", Body: "Buy cheap pills online, best price, visit https://pills.example.com now"}
+	ham := Content{Title: "Fibonacci", Body: goSnippet}
+
+	// no opinion until it has been trained enough
+	res, err := b.Check(spam)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Score, 0.0)
+
+	for i := 0; i < 5; i++ {
+		assert.NilError(t, b.Train(Content{Title: fmt.Sprintf("Cheap pills %d", i), Body: spam.Body}, true))
+		assert.NilError(t, b.Train(Content{Title: fmt.Sprintf("Snippet %d", i), Body: ham.Body}, false))
+	}
+
+	res, err = b.Check(Content{Title: "Best price", Body: "cheap pills, buy now at https://pills.example.com"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Score > 0.9, true)
+
+	res, err = b.Check(Content{Title: "Loop", Body: "for i := 0; i < 10; i++ {\n\tfmt.Println(i)\n}"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Score < 0.1, true)
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(&MemoryStore{})
+
+	v, err := f.Classify(Content{Title: "Fibonacci", Body: goSnippet})
+	assert.NilError(t, err)
+	assert.Equal(t, v.Spam, false)
+	assert.Equal(t, len(v.Reasons), 0)
+
+	v, err = f.Classify(Content{Title: "Deals", Body: strings.Repeat("deal https://deals.example.com\n", 8)})
+	assert.NilError(t, err)
+	assert.Equal(t, v.Spam, true)
+	assert.Equal(t, v.Score, 1.0)
+	assert.Equal(t, strings.Join(v.Reasons, "; "), "8 links in 9 words; 7 of 8 lines repeated")
+}
@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+
+	"snippetbox.derrc/internal/assert"
+)
+
+// test vectors from RFC 6238 Appendix B
+func TestGenerateRFC6238(t *testing.T) {
+	seed := "12345678901234567890"
+
+	keys := map[string][]byte{
+		"SHA1": []byte(seed),
+		"SHA256": []byte(seed + seed[:12]),
+		"SHA512": []byte(seed + seed + seed + seed[:4]),
+	}
+	hashes := map[string]func() hash.Hash{
+		"SHA1": sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+
+	tests := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got := generate(keys[tt.mode], step(time.Unix(tt.unix, 0)), 8, hashes[tt.mode])
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// base32 of the RFC 6238 SHA1 seed
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111109, 0)
+
+	code, err := Code(secret, now)
+	assert.NilError(t, err)
+	// last 6 digits of the RFC's 8 digit code
+	assert.Equal(t, code, "081804")
+
+	tests := []struct {
+		name string
+		code string
+		at time.Time
+		wantOK bool
+	}{
+		{"Current step", code, now, true},
+		{"Previous step", code, now.Add(Period), true},
+		{"Next step", code, now.Add(-Period), true},
+		{"Too old", code, now.Add(2 * Period), false},
+		{"Wrong code", "000000", now, false},
+		{"Wrong length", "81804", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, ok := Validate(secret, tt.code, tt.at)
+			assert.Equal(t, ok, tt.wantOK)
+			if ok {
+				assert.Equal(t, matched, step(now))
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NilError(t, err)
+
+	// 20 bytes is exactly 32 base32 characters
+	assert.Equal(t, len(secret), 32)
+
+	code, err := Code(secret, time.Now())
+	assert.NilError(t, err)
+
+	_, ok := Validate(secret, code, time.Now())
+	assert.Equal(t, ok, true)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "Snippetbox", "alice@example.com")
+
+	assert.StringContains(t, uri, "otpauth://totp/Snippetbox:alice@example.com?")
+	assert.StringContains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.StringContains(t, uri, "issuer=Snippetbox")
+}
@@ -4,10 +4,14 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// handles start with a letter so they can never be confused with a numeric user ID
+var HandleRX = regexp.MustCompile("^[a-z][a-z0-9_]{2,29}$")
 	
 type Validator struct {
 	// errors that can be associated with multiple fields
@@ -55,6 +59,12 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
+// returns true if the value is no more than n bytes long, for limits on
+// storage rather than what people see
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
 // returns true if the value contains at least n chars
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
@@ -65,6 +75,21 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
 
+// returns true if t is after min
+func After(t, min time.Time) bool {
+	return t.After(min)
+}
+
+// returns true if t is before max
+func Before(t, max time.Time) bool {
+	return t.Before(max)
+}
+
+// returns true if t is between min and max, inclusive
+func Between(t, min, max time.Time) bool {
+	return !t.Before(min) && !t.After(max)
+}
+
 // returns true if the value matches the provided regexp pattern
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
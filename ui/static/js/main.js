@@ -5,4 +5,175 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// solve the proof-of-work challenge on forms that have one: find a nonce such
+// that SHA-256(challenge + ":" + nonce) starts with the given number of zero
+// bits. Submitting waits until it's found.
+var challenge = document.querySelector("input[name='pow_challenge']");
+if (challenge && window.crypto && crypto.subtle) {
+	var powForm = challenge.form;
+	var powNonce = powForm.querySelector("input[name='pow_nonce']");
+	var powSubmit = powForm.querySelector("input[type='submit']");
+	var powSolved = false;
+	var powWaiting = false;
+
+	solveChallenge(challenge.value, parseInt(challenge.dataset.difficulty, 10)).then(function (nonce) {
+		powNonce.value = nonce;
+		powSolved = true;
+		if (powWaiting) {
+			powForm.submit();
+		}
+	});
+
+	powForm.addEventListener("submit", function (e) {
+		if (!powSolved) {
+			e.preventDefault();
+			powWaiting = true;
+			if (powSubmit) {
+				powSubmit.disabled = true;
+				powSubmit.value = "Checking...";
+			}
+		}
+	});
+}
+
+function leadingZeroBits(hash) {
+	var bytes = new Uint8Array(hash);
+	var n = 0;
+	for (var i = 0; i < bytes.length; i++) {
+		if (bytes[i] != 0) {
+			return n + Math.clz32(bytes[i]) - 24;
+		}
+		n += 8;
+	}
+	return n;
+}
+
+// hashes candidates in batches so the page stays responsive
+function solveChallenge(token, difficulty) {
+	var encoder = new TextEncoder();
+	var batchSize = 256;
+
+	function batch(start) {
+		var hashes = [];
+		for (var i = 0; i < batchSize; i++) {
+			hashes.push(crypto.subtle.digest("SHA-256", encoder.encode(token + ":" + (start + i))));
+		}
+		return Promise.all(hashes).then(function (results) {
+			for (var i = 0; i < results.length; i++) {
+				if (leadingZeroBits(results[i]) >= difficulty) {
+					return String(start + i);
+				}
+			}
+			return batch(start + batchSize);
+		});
+	}
+
+	return batch(0);
+}
+
+// expiry and publication dates are entered in the browser's timezone
+var timezoneInputs = document.querySelectorAll("input[name='timezone']");
+for (var i = 0; i < timezoneInputs.length; i++) {
+	if (!timezoneInputs[i].value && window.Intl) {
+		timezoneInputs[i].value = Intl.DateTimeFormat().resolvedOptions().timeZone;
+	}
+}
+
+// autosave the create form as a draft every few seconds while it's changing,
+// so nothing is lost if the session expires or the tab is closed
+var draftID = document.querySelector("input[data-autosave]");
+if (draftID && window.fetch) {
+	var draftForm = draftID.form;
+	var draftStatus = draftForm.querySelector(".draft-status");
+	var draftSaved = draftForm.elements["title"].value + "\u0000" + draftForm.elements["content"].value;
+	var draftSaving = false;
+
+	setInterval(function () {
+		var title = draftForm.elements["title"].value;
+		var content = draftForm.elements["content"].value;
+		var snapshot = title + "\u0000" + content;
+
+		if (draftSaving || snapshot === draftSaved || (!title.trim() && !content.trim())) {
+			return;
+		}
+		draftSaving = true;
+
+		fetch(draftID.dataset.autosave, {
+			method: "POST",
+			credentials: "same-origin",
+			headers: {
+				"Content-Type": "application/json",
+				"X-CSRF-Token": draftForm.elements["csrf_token"].value,
+			},
+			body: JSON.stringify({id: parseInt(draftID.value, 10) || 0, title: title, content: content}),
+		}).then(function (response) {
+			// logged out, what came back is the login page
+			if (response.redirected) {
+				throw new Error("Draft not saved, you've been logged out");
+			}
+
+			return response.json().then(function (result) {
+				// deleted in another tab, the next save starts a new one
+				if (response.status === 404) {
+					draftID.value = "";
+				}
+				if (!response.ok) {
+					throw new Error(result.error || "Draft not saved");
+				}
+
+				draftID.value = result.id;
+				draftSaved = snapshot;
+				draftStatus.textContent = "Draft saved at " + new Date(result.saved).toLocaleTimeString();
+			});
+		}).catch(function (err) {
+			draftStatus.textContent = err.message;
+		}).finally(function () {
+			draftSaving = false;
+		});
+	}, 10000);
+}
+
+// add snippets to the home page as they're published
+var latest = document.querySelector("div[data-events]");
+if (latest && window.EventSource) {
+	var latestSource = new EventSource(latest.dataset.events);
+
+	latestSource.addEventListener("snippet", function (e) {
+		var snippet = JSON.parse(e.data);
+
+		// already there, e.g. sent again after reconnecting
+		if (latest.querySelector("tr[data-id='" + snippet.id + "']")) {
+			return;
+		}
+
+		var table = latest.querySelector("table");
+		if (!table) {
+			table = document.createElement("table");
+			var header = table.insertRow();
+			["Title", "Created", "ID"].forEach(function (title) {
+				var th = document.createElement("th");
+				th.textContent = title;
+				header.appendChild(th);
+			});
+			latest.replaceChildren(table);
+		}
+
+		// newest first, below the header
+		var row = table.insertRow(1);
+		row.dataset.id = snippet.id;
+
+		var link = document.createElement("a");
+		link.href = "/snippet/view/" + snippet.id;
+		link.textContent = snippet.title;
+		row.insertCell().appendChild(link);
+		row.insertCell().textContent = snippet.created;
+		row.insertCell().textContent = "#" + snippet.id;
+
+		// the page shows the latest 10
+		while (table.rows.length > 11) {
+			table.deleteRow(-1);
+		}
+	});
+}